@@ -0,0 +1,182 @@
+package hconf
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+const tagLabeled = "hlabeled"
+
+// Block is embedded in the element type of an hlabeled field, and records
+// the label and position of each block. A field tagged hlabeled:"server" of
+// type map[string]T or []T collects every server "label" { ... } block at
+// the top level of the configuration, keyed by label. Blocks with the same
+// label are merged like sections.
+type Block struct {
+	label  string
+	source token.Pos
+}
+
+// Label returns the label of the block.
+func (b *Block) Label() string {
+	return b.label
+}
+
+// Source returns where the block was first declared.
+func (b *Block) Source() token.Pos {
+	return b.source
+}
+
+func (b *Block) setBlock(label string, source token.Pos) {
+	b.label = label
+	b.source = source
+}
+
+type blockSetter interface {
+	Label() string
+	setBlock(label string, source token.Pos)
+}
+
+var blockSetterType = reflect.TypeOf((*blockSetter)(nil)).Elem()
+
+// labeledFields returns the hlabeled fields of obj by block type.
+func (hc *HC) labeledFields(obj reflect.Value) (map[string]reflect.Value, error) {
+	result := obj.Elem()
+	structType := result.Type()
+	labeledFields := make(map[string]reflect.Value)
+	for i := 0; i < structType.NumField(); i++ {
+		fieldType := structType.Field(i)
+		field := result.Field(i)
+		blockType := fieldType.Tag.Get(tagLabeled)
+		if blockType == "" || !field.CanSet() {
+			continue
+		}
+
+		if blockType == "section" || blockType == "when" {
+			return nil, fmt.Errorf("%s: %s block type '%s' is reserved", fieldType.Name, tagLabeled, blockType)
+		}
+
+		if !isLabeledType(field.Type()) {
+			return nil, fmt.Errorf("%s: %s fields must be map[string]T or []T, where T embeds hconf.Block", fieldType.Name, tagLabeled)
+		}
+		labeledFields[blockType] = field
+	}
+	return labeledFields, nil
+}
+
+func isLabeledType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return false
+		}
+	case reflect.Slice:
+	default:
+		return false
+	}
+	return t.Elem().Kind() == reflect.Struct && reflect.PtrTo(t.Elem()).Implements(blockSetterType)
+}
+
+// node invariants:
+//  node.Keys[0] == blockType
+//  node.Keys[1] == label
+func (hc *HC) handleLabeled(st *decodeState, blockType string, field reflect.Value, node *ast.ObjectItem) error {
+	label, err := getKeyAsString(node.Keys[1])
+	if err != nil {
+		return err
+	}
+
+	obj, ok := node.Val.(*ast.ObjectType)
+	if !ok {
+		return &parser.PosError{
+			Pos: node.Val.Pos(),
+			Err: fmt.Errorf("expected object body for %s %s", blockType, label),
+		}
+	}
+
+	path := blockType + "." + label
+	if _, ok := st.sections[path]; !ok {
+		st.sections[path] = node.Keys[0].Pos()
+	}
+
+	entry, store := labeledEntry(field, label)
+	if bs := entry.Addr().Interface().(blockSetter); bs.Label() == "" {
+		bs.setBlock(label, node.Keys[0].Pos())
+	}
+
+	err = hc.handleBlock(st, path, entry, obj)
+	if store != nil {
+		store()
+	}
+	return err
+}
+
+// labeledEntry returns the entry of field for label, adding it if needed.
+// Map entries are not addressable, so for maps the entry is a copy that
+// store writes back.
+func labeledEntry(field reflect.Value, label string) (reflect.Value, func()) {
+	if field.Kind() == reflect.Map {
+		if field.IsNil() {
+			field.Set(reflect.MakeMap(field.Type()))
+		}
+
+		key := reflect.ValueOf(label).Convert(field.Type().Key())
+		entry := reflect.New(field.Type().Elem()).Elem()
+		if existing := field.MapIndex(key); existing.IsValid() {
+			entry.Set(existing)
+		}
+		return entry, func() {
+			field.SetMapIndex(key, entry)
+		}
+	}
+
+	for i := 0; i < field.Len(); i++ {
+		if field.Index(i).Addr().Interface().(blockSetter).Label() == label {
+			return field.Index(i), nil
+		}
+	}
+	field.Set(reflect.Append(field, reflect.Zero(field.Type().Elem())))
+	return field.Index(field.Len() - 1), nil
+}
+
+// labeledKeyFields appends the keys of every entry of the hlabeled field to
+// keys, with map entries in label order.
+func labeledKeyFields(keys []keyField, blockType string, field reflect.Value) []keyField {
+	if !isLabeledType(field.Type()) {
+		return keys
+	}
+
+	add := func(label string, entry reflect.Value, store func()) {
+		start := len(keys)
+		keys = blockKeyFields(keys, label, nil, entry)
+		for i := start; i < len(keys); i++ {
+			keys[i].blockType = blockType
+			keys[i].store = store
+		}
+	}
+
+	if field.Kind() == reflect.Slice {
+		for i := 0; i < field.Len(); i++ {
+			entry := field.Index(i)
+			add(entry.Addr().Interface().(blockSetter).Label(), entry, nil)
+		}
+		return keys
+	}
+
+	labels := make([]string, 0, field.Len())
+	for _, key := range field.MapKeys() {
+		labels = append(labels, key.String())
+	}
+	sort.Strings(labels)
+
+	for _, label := range labels {
+		entry, store := labeledEntry(field, label)
+		add(label, entry, store)
+	}
+	return keys
+}
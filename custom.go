@@ -0,0 +1,108 @@
+package hconf
+
+import (
+	"reflect"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+// Unmarshaler is implemented by custom value types that decode themselves,
+// such as a URL or CIDR wrapper. UnmarshalHCL is called on a pointer to the
+// field with the value's node and position. Strings passed to Set arrive as
+// string literals with no position.
+//
+// A custom type that also has Source, SetSource and IsSet methods is treated
+// like the built in wrapper types by Get, DecodeEnv and Encode.
+type Unmarshaler interface {
+	UnmarshalHCL(node ast.Node, pos token.Pos) error
+}
+
+// Marshaler is implemented by custom value types that can be written by
+// Encode and EditAndSave.
+type Marshaler interface {
+	MarshalHCL() (ast.Node, error)
+}
+
+// UnmarshalFunc decodes node, found at pos, into out, which points to a
+// value of a registered type.
+type UnmarshalFunc func(out interface{}, node ast.Node, pos token.Pos) error
+
+// MarshalFunc returns the node to write for in, a value of a registered
+// type.
+type MarshalFunc func(in interface{}) (ast.Node, error)
+
+type registeredType struct {
+	unmarshal UnmarshalFunc
+	marshal   MarshalFunc
+}
+
+// RegisterType decodes fields of the type of sample with unmarshal, and
+// writes them with marshal, for types that cannot implement Unmarshaler and
+// Marshaler themselves. marshal may be nil if the type is never written.
+// Registered types take precedence over the interfaces and built in types.
+// Types must be registered before the Config is passed to New; types
+// registered later are not seen by that HC.
+func (c *Config) RegisterType(sample interface{}, unmarshal UnmarshalFunc, marshal MarshalFunc) {
+	if c.types == nil {
+		c.types = make(map[reflect.Type]registeredType)
+	}
+	c.types[reflect.TypeOf(sample)] = registeredType{
+		unmarshal: unmarshal,
+		marshal:   marshal,
+	}
+}
+
+// isCustom reports whether result is of a registered type or implements
+// Unmarshaler.
+func (hc *HC) isCustom(result reflect.Value) bool {
+	if _, ok := hc.types[result.Type()]; ok {
+		return true
+	}
+	return result.CanAddr() && result.Addr().Type().Implements(unmarshalerType)
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+// unmarshalCustom decodes node into result, which isCustom accepts.
+func (hc *HC) unmarshalCustom(node ast.Node, pos token.Pos, result reflect.Value) error {
+	out := result.Addr().Interface()
+	if rt, ok := hc.types[result.Type()]; ok {
+		return rt.unmarshal(out, node, pos)
+	}
+	return out.(Unmarshaler).UnmarshalHCL(node, pos)
+}
+
+// customNode returns the node to write for a value, or a pointer to a
+// value, of a registered type or one implementing Marshaler. A pointer type
+// may be registered itself. ok is false for other values.
+func (hc *HC) customNode(value interface{}) (node ast.Node, ok bool, err error) {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return nil, false, nil
+	}
+
+	if v.Kind() != reflect.Ptr {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		v = p
+	} else if v.IsNil() {
+		return nil, false, nil
+	}
+
+	if rt, ok := hc.types[v.Type()]; ok && rt.marshal != nil {
+		node, err = rt.marshal(v.Interface())
+		return node, true, err
+	}
+
+	if rt, ok := hc.types[v.Type().Elem()]; ok && rt.marshal != nil {
+		node, err = rt.marshal(v.Elem().Interface())
+		return node, true, err
+	}
+
+	if m, ok := v.Interface().(Marshaler); ok {
+		node, err = m.MarshalHCL()
+		return node, true, err
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,45 @@
+package hconf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// applyDefaults sets each value with an hdefault tag that was not set by the
+// configuration. The value is parsed like a string passed to Set, and is
+// left with IsSet false, IsDefault true and a Source of DefaultSource.
+func (hc *HC) applyDefaults(out interface{}) error {
+	val := reflect.ValueOf(out)
+	if val.Kind() != reflect.Ptr {
+		return errors.New("out must be a pointer")
+	}
+
+	for _, kf := range hc.keyFields(val) {
+		def, ok := kf.field.Tag.Lookup(tagDefault)
+		if !ok {
+			continue
+		}
+
+		vif := kf.value.Addr().Interface()
+		dm, ok := vif.(defaultMarker)
+		if !ok {
+			return fmt.Errorf("%s: %s tag is not supported on %s", kf.path(), tagDefault, kf.value.Type())
+		}
+
+		if vif.(isSetter).IsSet() {
+			continue
+		}
+
+		err := hc.setValue(vif, kf.block(), kf.key, def)
+		if err != nil {
+			return fmt.Errorf("%s: invalid %s tag: %v", kf.path(), tagDefault, err)
+		}
+		dm.markDefault()
+		if kf.store != nil {
+			kf.store()
+		}
+	}
+
+	return nil
+}
@@ -2,11 +2,16 @@ package hconf
 
 import (
 	"bytes"
+	"encoding"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
@@ -15,86 +20,808 @@ import (
 	"github.com/hashicorp/hcl/hcl/token"
 )
 
-// EditAndSave open's existing file, edits section/key value, saves back as a formatted HCL. (kitchen sink method)
+// EditAndSave open's existing file, edits section/key value, and saves it back. Only the edited value
+// changes; comments and formatting elsewhere in the file are kept. An empty section edits a top
+// level key. (kitchen sink method)
 func (hc *HC) EditAndSave(filename string, section string, key string, value interface{}) error {
-	err := hc.editAndSave(filename, section, key, value)
+	e, err := hc.OpenForEdit(filename)
 	if err != nil {
-		switch xerr := err.(type) {
-		case *parser.PosError:
-			if xerr.Pos.Filename == "" {
-				xerr.Pos.Filename = filename
-			}
-		}
 		return err
 	}
-	return nil
+
+	err = e.Set(section, key, value)
+	if err != nil {
+		e.Discard()
+		return err
+	}
+	return e.Commit()
 }
 
-func (hc *HC) editAndSave(filename string, section string, key string, value interface{}) error {
-	data, err := ioutil.ReadFile(filename)
-	if err != nil && !os.IsNotExist(err) {
+// EditDryRun is EditAndSave without the save: it returns what the file
+// would contain and a unified diff against the current file. It takes no
+// lock and leaves the file system untouched.
+func (hc *HC) EditDryRun(filename string, section string, key string, value interface{}) (*DryRun, error) {
+	e, err := hc.readEditor(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer e.Discard()
+
+	err = e.Set(section, key, value)
+	if err != nil {
+		return nil, err
+	}
+	return e.DryRun()
+}
+
+// EditAndSaveFor is EditAndSave checked against schema, a pointer to the
+// struct the file is decoded into. Sections, keys and values that HC.Set
+// would reject are refused before the file is touched, and every value in
+// the edited file must still decode into schema before it is saved. The
+// check does not evaluate when conditions, apply defaults or validate, so a
+// file that is incomplete for this host can still be edited.
+func (hc *HC) EditAndSaveFor(schema interface{}, filename string, section string, key string, value interface{}) error {
+	check, err := newSchema(schema)
+	if err != nil {
 		return err
 	}
 
-	tree, err := hcl.ParseBytes(data)
+	err = hc.Set(check, section, key, value)
+	if err != nil {
+		return err
+	}
+
+	// write the value as Set converted it, so "true" for a Bool is written
+	// as true and not as a string
+	v, err := hc.lookup(check, section, key)
+	if err != nil {
+		return err
+	}
+
+	e, err := hc.OpenForEdit(filename)
+	if err != nil {
+		return err
+	}
+
+	err = e.Set(section, key, wrapperValue(v.Addr().Interface()))
+	if err == nil {
+		err = hc.typeCheck(schema, filename, e.data)
+	}
+	if err != nil {
+		e.Discard()
+		return err
+	}
+	return e.Commit()
+}
+
+// typeCheck decodes data into a new value of schema without evaluating
+// when conditions, applying defaults or validating.
+func (hc *HC) typeCheck(schema interface{}, filename string, data []byte) error {
+	check, err := newSchema(schema)
+	if err != nil {
+		return err
+	}
+
+	st := hc.newDecodeState()
+	st.check = true
+	err = hc.decode(st, check, filename, data)
+	if err != nil {
+		return fixupError(err, filename)
+	}
+	return st.err()
+}
+
+// newSchema returns a pointer to a new zero value of the struct schema
+// points to.
+func newSchema(schema interface{}) (interface{}, error) {
+	t := reflect.TypeOf(schema)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("schema must be a pointer to a struct")
+	}
+	return reflect.New(t.Elem()).Interface(), nil
+}
+
+// DeleteAndSave removes section/key from filename, so it reverts to its
+// default. A section left empty is removed as well, and an empty section
+// removes a top level key. Comments attached to the removed lines go with
+// them; the rest of the file is untouched. A missing file is left missing.
+func (hc *HC) DeleteAndSave(filename string, section string, key string) error {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		// nothing to delete, so don't create a directory or lock for it
+		return nil
+	}
+
+	e, err := hc.OpenForEdit(filename)
 	if err != nil {
 		return err
 	}
 
+	err = e.Delete(section, key)
+	if err != nil {
+		e.Discard()
+		return err
+	}
+	return e.Commit()
+}
+
+// DeleteSectionAndSave removes every block for section from filename.
+func (hc *HC) DeleteSectionAndSave(filename string, section string) error {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		// nothing to delete, so don't create a directory or lock for it
+		return nil
+	}
+
+	e, err := hc.OpenForEdit(filename)
+	if err != nil {
+		return err
+	}
+
+	err = e.DeleteSection(section)
+	if err != nil {
+		e.Discard()
+		return err
+	}
+	return e.Commit()
+}
+
+// deleteSectionKey returns data without section.key, where key may be a
+// dotted path into sub-blocks. Sections and sub-blocks left empty are
+// removed.
+func deleteSectionKey(data []byte, section string, key string) ([]byte, error) {
+	_, root, err := parseRoot(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sections, err := findSections(root, section)
+	if err != nil {
+		return nil, err
+	}
+
+	var splices []splice
+	for _, sectionItem := range sections {
+		remove, empty, err := deleteBlockKey(data, sectionItem.Val.(*ast.ObjectType), section, strings.Split(key, "."))
+		if err != nil {
+			return nil, err
+		}
+
+		if empty {
+			splices = append(splices, removeItem(data, sectionItem))
+		} else {
+			splices = append(splices, remove...)
+		}
+	}
+
+	return applySplices(data, splices), nil
+}
+
+// deleteBlockKey returns the splices removing the dotted key path parts
+// from obj, and whether that would leave obj empty. Sub-blocks left empty
+// are removed whole. path names obj in errors.
+func deleteBlockKey(data []byte, obj *ast.ObjectType, path string, parts []string) ([]splice, bool, error) {
+	var splices []splice
+	removed := 0
+	for _, item := range obj.List.Items {
+		isValue, sub, err := matchKey(item, path, parts)
+		if err != nil {
+			return nil, false, err
+		}
+
+		switch {
+		case isValue:
+			splices = append(splices, removeItem(data, item))
+			removed++
+		case sub != nil:
+			remove, empty, err := deleteBlockKey(data, sub, path+"."+parts[0], parts[1:])
+			if err != nil {
+				return nil, false, err
+			}
+
+			if empty {
+				splices = append(splices, removeItem(data, item))
+				removed++
+			} else {
+				splices = append(splices, remove...)
+			}
+		}
+	}
+
+	return splices, removed > 0 && removed == len(obj.List.Items), nil
+}
+
+// deleteTopLevelKey returns data without the top level key.
+func deleteTopLevelKey(data []byte, key string) ([]byte, error) {
+	_, root, err := parseRoot(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var splices []splice
+	for _, item := range root.Items {
+		if len(item.Keys) != 1 {
+			continue
+		}
+
+		keyName, err := getKeyAsString(item.Keys[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if keyName == key {
+			splices = append(splices, removeItem(data, item))
+		}
+	}
+	return applySplices(data, splices), nil
+}
+
+// deleteSection returns data without any block for section.
+func deleteSection(data []byte, section string) ([]byte, error) {
+	_, root, err := parseRoot(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sections, err := findSections(root, section)
+	if err != nil {
+		return nil, err
+	}
+
+	var splices []splice
+	for _, item := range sections {
+		splices = append(splices, removeItem(data, item))
+	}
+	return applySplices(data, splices), nil
+}
+
+// itemSpan returns the range of item and its comments. If the item has
+// lines to itself, the range covers those lines whole and own is true.
+func itemSpan(data []byte, item *ast.ObjectItem) (start int, end int, own bool) {
+	start = item.Pos().Offset
+	if item.LeadComment != nil {
+		start = item.LeadComment.List[0].Start.Offset
+	}
+
+	_, end = nodeRange(item.Val)
+	if item.LineComment != nil {
+		last := item.LineComment.List[len(item.LineComment.List)-1]
+		if last.Start.Offset >= end {
+			end = last.Start.Offset + len(last.Text)
+		}
+	}
+
+	lineStart := bytes.LastIndexByte(data[:start], '\n') + 1
+	lineEnd := end
+	if end == 0 || data[end-1] != '\n' {
+		lineEnd = len(data)
+		if i := bytes.IndexByte(data[end:], '\n'); i >= 0 {
+			lineEnd = end + i + 1
+		}
+	}
+
+	if !isBlank(data[lineStart:start]) || !isBlank(bytes.TrimLeft(data[end:lineEnd], " \t,")) {
+		return start, end, false
+	}
+	return lineStart, lineEnd, true
+}
+
+// removeItem removes item along with its comments. If the item has lines
+// to itself they are removed whole, along with a blank line that would
+// otherwise be doubled up.
+func removeItem(data []byte, item *ast.ObjectItem) splice {
+	lineStart, lineEnd, own := itemSpan(data, item)
+	if !own {
+		end := lineEnd
+		for end < len(data) && (data[end] == ' ' || data[end] == '\t' || data[end] == ',') {
+			end++
+		}
+		return splice{start: lineStart, end: end}
+	}
+
+	prevBlank := lineStart == 0
+	prevStart := lineStart
+	if lineStart > 0 {
+		prevStart = bytes.LastIndexByte(data[:lineStart-1], '\n') + 1
+		prevBlank = isBlank(data[prevStart : lineStart-1])
+	}
+
+	if lineEnd < len(data) {
+		nextEnd := len(data)
+		if i := bytes.IndexByte(data[lineEnd:], '\n'); i >= 0 {
+			nextEnd = lineEnd + i + 1
+		}
+		if prevBlank && isBlank(data[lineEnd:nextEnd]) {
+			lineEnd = nextEnd
+		}
+	} else if lineStart > 0 && prevBlank {
+		lineStart = prevStart
+	}
+
+	return splice{start: lineStart, end: lineEnd}
+}
+
+func isBlank(b []byte) bool {
+	return len(bytes.TrimSpace(b)) == 0
+}
+
+// setTopLevelKey returns data with the top level key set to val. A new key
+// goes after the last top level key, or before the first block if there are
+// none.
+func setTopLevelKey(data []byte, key string, val ast.Node) ([]byte, error) {
+	_, root, err := parseRoot(data)
+	if err != nil {
+		return nil, err
+	}
+
+	valText, err := printNode(val)
+	if err != nil {
+		return nil, err
+	}
+
+	var splices []splice
+	var last *ast.ObjectItem
+	for _, item := range root.Items {
+		if len(item.Keys) != 1 {
+			continue
+		}
+		last = item
+
+		keyName, err := getKeyAsString(item.Keys[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if keyName == key {
+			splices = append(splices, replaceNode(data, item.Val, valText))
+		}
+	}
+
+	if len(splices) > 0 {
+		return applySplices(data, splices), nil
+	}
+
+	text := key + " = " + valText
+	switch {
+	case last != nil:
+		_, end, own := itemSpan(data, last)
+		if own {
+			if end > 0 && data[end-1] != '\n' {
+				text = "\n" + text
+			}
+			text += "\n"
+		} else {
+			text = " " + text
+		}
+		return applySplices(data, []splice{{start: end, end: end, text: text}}), nil
+	case len(root.Items) > 0:
+		start, _, own := itemSpan(data, root.Items[0])
+		if own {
+			text += "\n\n"
+		} else {
+			text += " "
+		}
+		return applySplices(data, []splice{{start: start, end: start, text: text}}), nil
+	}
+	return appendBlock(data, text), nil
+}
+
+// splice replaces data[start:end] with text.
+type splice struct {
+	start int
+	end   int
+	text  string
+}
+
+// applySplices applies non-overlapping splices to data.
+func applySplices(data []byte, splices []splice) []byte {
+	sort.Slice(splices, func(i, j int) bool {
+		return splices[i].start > splices[j].start
+	})
+
+	out := append([]byte{}, data...)
+	for _, sp := range splices {
+		rest := append([]byte(sp.text), out[sp.end:]...)
+		out = append(out[:sp.start], rest...)
+	}
+	return out
+}
+
+func parseRoot(data []byte) (*ast.File, *ast.ObjectList, error) {
+	tree, err := hcl.ParseBytes(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	root, ok := tree.Node.(*ast.ObjectList)
 	if !ok {
-		return &parser.PosError{
+		return nil, nil, &parser.PosError{
 			Pos: tree.Pos(),
 			Err: fmt.Errorf("invalid config: missing root objects: %#v", tree.Node),
 		}
 	}
+	return tree, root, nil
+}
 
-	sectionFound := false
+// findSections returns every section block named section. The body of each
+// is known to be an *ast.ObjectType.
+func findSections(root *ast.ObjectList, section string) ([]*ast.ObjectItem, error) {
+	var found []*ast.ObjectItem
+	for _, item := range root.Items {
+		if len(item.Keys) != 2 || item.Keys[0].Token.Text != "section" {
+			continue
+		}
 
-	setObjKey := &ast.ObjectKey{
-		Token: token.Token{
-			Type: token.IDENT,
-			Text: key,
-		},
+		sectionName, err := getKeyAsString(item.Keys[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if sectionName != section {
+			continue
+		}
+
+		if _, ok := item.Val.(*ast.ObjectType); !ok {
+			return nil, &parser.PosError{
+				Pos: item.Val.Pos(),
+				Err: fmt.Errorf("expected object body for section %s", sectionName),
+			}
+		}
+		found = append(found, item)
+	}
+	return found, nil
+}
+
+// setSectionKey returns data with section.key set to val. Only the bytes of
+// an existing value are replaced, so comments and formatting elsewhere are
+// kept. A missing key is added at the end of the section, and a missing
+// section at the end of the file. A key in a sub-block is a dotted path
+// within the section. Keys may contain dots themselves, so a missing key is
+// added to the deepest existing sub-block on its path, with the rest of the
+// path as a dotted key, which decodes the same as nested sub-blocks.
+func setSectionKey(data []byte, section string, key string, val ast.Node) ([]byte, error) {
+	_, root, err := parseRoot(data)
+	if err != nil {
+		return nil, err
 	}
 
-	var setNode ast.Node
+	valText, err := printNode(val)
+	if err != nil {
+		return nil, err
+	}
+
+	sections, err := findSections(root, section)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(key, ".")
+	if len(sections) == 0 {
+		block, err := printNode(&ast.File{
+			Node: &ast.ObjectList{
+				Items: []*ast.ObjectItem{
+					sectionItem(section, keyItem(key, val)),
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return appendBlock(data, block), nil
+	}
+
+	var splices []splice
+	for _, sectionItem := range sections {
+		items, err := blockKeys(sectionItem.Val.(*ast.ObjectType), section, parts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			indent, _ := lineIndent(data, item.Pos().Offset)
+			text := indentText(valText, leadingSpace(indent), blockIndentUnit(data, sectionItem.Val.(*ast.ObjectType)))
+			splices = append(splices, replaceNode(data, item.Val, text))
+		}
+	}
+
+	if len(splices) == 0 {
+		// the last block wins when decoding, so add the key there
+		last, depth := lastBlock(sections[len(sections)-1].Val.(*ast.ObjectType), parts[:len(parts)-1])
+		text := strings.Join(parts[depth:], ".") + " = " + valText
+		splices = append(splices, insertItem(data, last, text))
+	}
+
+	return applySplices(data, splices), nil
+}
+
+// blockKeys returns the items for the dotted key path parts within obj,
+// descending into sub-blocks. path names obj in errors.
+func blockKeys(obj *ast.ObjectType, path string, parts []string) ([]*ast.ObjectItem, error) {
+	var found []*ast.ObjectItem
+	for _, item := range obj.List.Items {
+		isValue, sub, err := matchKey(item, path, parts)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case isValue:
+			found = append(found, item)
+		case sub != nil:
+			items, err := blockKeys(sub, path+"."+parts[0], parts[1:])
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, items...)
+		}
+	}
+	return found, nil
+}
+
+// matchKey reports whether item, in the block at path, is the value for the
+// dotted key path parts, or else returns the sub-block it leads into. The
+// rest of the path may be a single key with dots in it. A block written
+// without "=" is never a value, but a map written as "labels = { ... }" is.
+func matchKey(item *ast.ObjectItem, path string, parts []string) (bool, *ast.ObjectType, error) {
+	if len(item.Keys) != 1 {
+		return false, nil, &parser.PosError{
+			Pos: item.Pos(),
+			Err: fmt.Errorf("expected flat keys under section %s", path),
+		}
+	}
+
+	keyName, err := getKeyAsString(item.Keys[0])
+	if err != nil {
+		return false, nil, err
+	}
+
+	sub, isBlock := item.Val.(*ast.ObjectType)
+	switch {
+	case keyName == strings.Join(parts, ".") && (!isBlock || item.Assign.IsValid()):
+		return true, nil, nil
+	case len(parts) > 1 && keyName == parts[0] && isBlock:
+		return false, sub, nil
+	}
+	return false, nil, nil
+}
+
+// lastBlock follows the sub-blocks named by parts down from obj, taking
+// the last of each name as decoding does. It returns the deepest block
+// found and how many of parts lead to it.
+func lastBlock(obj *ast.ObjectType, parts []string) (*ast.ObjectType, int) {
+	for depth, part := range parts {
+		var next *ast.ObjectType
+		for _, item := range obj.List.Items {
+			if len(item.Keys) != 1 {
+				continue
+			}
+
+			keyName, err := getKeyAsString(item.Keys[0])
+			if err != nil || keyName != part {
+				continue
+			}
+
+			if sub, ok := item.Val.(*ast.ObjectType); ok {
+				next = sub
+			}
+		}
+
+		if next == nil {
+			return obj, depth
+		}
+		obj = next
+	}
+	return obj, len(parts)
+}
+
+func printNode(n ast.Node) (string, error) {
+	buf := &bytes.Buffer{}
+	err := printer.Fprint(buf, n)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// nodeRange returns the offsets of the bytes n was parsed from.
+func nodeRange(n ast.Node) (int, int) {
+	switch v := n.(type) {
+	case *ast.LiteralType:
+		return v.Token.Pos.Offset, v.Token.Pos.Offset + len(v.Token.Text)
+	case *ast.ListType:
+		return v.Lbrack.Offset, v.Rbrack.Offset + 1
+	case *ast.ObjectType:
+		return v.Lbrace.Offset, v.Rbrace.Offset + 1
+	}
+	return n.Pos().Offset, n.Pos().Offset
+}
+
+// replaceNode replaces the value n with text.
+func replaceNode(data []byte, n ast.Node, text string) splice {
+	start, end := nodeRange(n)
+	if bytes.HasSuffix(data[start:end], []byte("\n")) && !strings.HasSuffix(text, "\n") {
+		// heredocs include the newline ending their last line
+		text += "\n"
+	}
+	return splice{start: start, end: end, text: text}
+}
+
+// insertItem adds the item text at the end of obj. When the closing brace is
+// on its own line the item goes on a new line, indented like the others.
+func insertItem(data []byte, obj *ast.ObjectType, text string) splice {
+	rbrace := obj.Rbrace.Offset
+	lineStart := bytes.LastIndexByte(data[:rbrace], '\n') + 1
+	if len(bytes.TrimSpace(data[lineStart:rbrace])) != 0 {
+		// single line block
+		if rbrace > 0 && data[rbrace-1] != ' ' {
+			text = " " + text
+		}
+		return splice{start: rbrace, end: rbrace, text: text + " "}
+	}
+
+	indent := itemIndent(data, obj)
+	text = indentText(text, indent, blockIndentUnit(data, obj))
+	return splice{start: lineStart, end: lineStart, text: indent + text + "\n"}
+}
+
+// blockIndentUnit returns the indentation of items in obj relative to its
+// opening line, which is taken as one level of indentation in the file.
+func blockIndentUnit(data []byte, obj *ast.ObjectType) string {
+	outer, _ := lineIndent(data, obj.Lbrace.Offset)
+	return strings.TrimPrefix(itemIndent(data, obj), leadingSpace(outer))
+}
+
+// indentText adjusts printed text that spans several lines to go on a line
+// starting with indent, using unit for each level of nesting.
+func indentText(text string, indent string, unit string) string {
+	if unit != "" {
+		text = reindent(text, unit)
+	}
+	return strings.Replace(text, "\n", "\n"+indent, -1)
+}
+
+// reindent replaces each level of the printer's two space indentation in
+// text with unit, so inserted blocks match the file around them.
+func reindent(text string, unit string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		lines[i] = strings.Repeat(unit, (len(line)-len(trimmed))/2) + trimmed
+	}
+	return strings.Join(lines, "\n")
+}
+
+// itemIndent returns the indentation of the first item in obj, or that of
+// its opening line plus two spaces if it has none.
+func itemIndent(data []byte, obj *ast.ObjectType) string {
+	if len(obj.List.Items) > 0 {
+		if indent, ok := lineIndent(data, obj.List.Items[0].Pos().Offset); ok {
+			return indent
+		}
+	}
+
+	indent, _ := lineIndent(data, obj.Lbrace.Offset)
+	return leadingSpace(indent) + "  "
+}
+
+// lineIndent returns the text between the start of the line and offset, and
+// whether it is all whitespace.
+func lineIndent(data []byte, offset int) (string, bool) {
+	lineStart := bytes.LastIndexByte(data[:offset], '\n') + 1
+	prefix := string(data[lineStart:offset])
+	return prefix, strings.TrimSpace(prefix) == ""
+}
+
+func leadingSpace(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+// appendBlock adds block to the end of data, separated by a blank line.
+func appendBlock(data []byte, block string) []byte {
+	out := append([]byte{}, data...)
+	if len(bytes.TrimSpace(out)) != 0 {
+		if !bytes.HasSuffix(out, []byte("\n")) {
+			out = append(out, '\n')
+		}
+		out = append(out, '\n')
+	}
+	out = append(out, block...)
+	return append(out, '\n')
+}
+
+// editValueNode returns the node for setting key to value.
+func (hc *HC) editValueNode(section string, key string, value interface{}) (ast.Node, error) {
+	node, ok, err := hc.customNode(value)
+	if err != nil {
+		return nil, &parser.PosError{
+			Err: fmt.Errorf("invalid set: %s.%s: %v", section, key, err),
+		}
+	}
+	if ok {
+		return node, nil
+	}
+
+	node, ok = valueNode(value)
+	if !ok {
+		return nil, &parser.PosError{
+			Err: fmt.Errorf("invalid set: unknown type %T trying to set %s.%s = %#v", value, section, key, value),
+		}
+	}
+	return node, nil
+}
+
+// valueNode returns the HCL literal for a Go value, or false if the type of
+// value cannot be written.
+func valueNode(value interface{}) (ast.Node, bool) {
 	switch v := value.(type) {
 	case string:
-		setNode = &ast.LiteralType{
+		return &ast.LiteralType{
 			Token: token.Token{
 				Type: token.STRING,
 				Text: strconv.Quote(v),
 			},
-		}
+		}, true
 	case int:
-		setNode = &ast.LiteralType{
+		return &ast.LiteralType{
 			Token: token.Token{
 				Type: token.NUMBER,
 				Text: fmt.Sprintf("%d", v),
 			},
-		}
+		}, true
 	case int32:
-		setNode = &ast.LiteralType{
+		return &ast.LiteralType{
 			Token: token.Token{
 				Type: token.NUMBER,
 				Text: fmt.Sprintf("%d", v),
 			},
-		}
+		}, true
 	case int64:
-		setNode = &ast.LiteralType{
+		return &ast.LiteralType{
 			Token: token.Token{
 				Type: token.NUMBER,
 				Text: fmt.Sprintf("%d", v),
 			},
-		}
+		}, true
+	case float64:
+		return &ast.LiteralType{
+			Token: token.Token{
+				Type: token.FLOAT,
+				Text: strconv.FormatFloat(v, 'f', -1, 64),
+			},
+		}, true
+	case time.Duration:
+		return &ast.LiteralType{
+			Token: token.Token{
+				Type: token.STRING,
+				Text: strconv.Quote(v.String()),
+			},
+		}, true
 	case bool:
-		setNode = &ast.LiteralType{
+		return &ast.LiteralType{
 			Token: token.Token{
 				Type: token.BOOL,
 				Text: fmt.Sprintf("%t", v),
 			},
+		}, true
+	case []int64:
+		lt := &ast.ListType{}
+		for _, ent := range v {
+			entNode, _ := valueNode(ent)
+			lt.Add(entNode)
+		}
+		return lt, true
+	case []bool:
+		lt := &ast.ListType{}
+		for _, ent := range v {
+			entNode, _ := valueNode(ent)
+			lt.Add(entNode)
 		}
+		return lt, true
+	case []float64:
+		lt := &ast.ListType{}
+		for _, ent := range v {
+			entNode, _ := valueNode(ent)
+			lt.Add(entNode)
+		}
+		return lt, true
 	case []string:
 		lt := &ast.ListType{
 			List: make([]ast.Node, 0, len(v)),
@@ -108,107 +835,179 @@ func (hc *HC) editAndSave(filename string, section string, key string, value int
 			}
 			lt.List = append(lt.List, entNode)
 		}
-		setNode = lt
+		return lt, true
 	default:
-		return &parser.PosError{
-			Pos: tree.Pos(),
-			Err: fmt.Errorf("invalid set: unknown type %T trying to set %s.%s = %#v", v, key, section, v),
+		return reflectValueNode(reflect.ValueOf(value))
+	}
+}
+
+// reflectValueNode returns the HCL literal for a value of any other type by
+// its kind, such as a named string, a uint, a slice or a map with string
+// keys. Types implementing encoding.TextMarshaler are written as strings.
+func reflectValueNode(v reflect.Value) (ast.Node, bool) {
+	if !v.IsValid() {
+		return nil, false
+	}
+
+	if v.Type() == durationType {
+		// written as a string, since a bare number is read back as seconds
+		return valueNode(time.Duration(v.Int()))
+	}
+
+	if tm, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		if err != nil {
+			return nil, false
+		}
+		return valueNode(string(text))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return valueNode(v.String())
+	case reflect.Bool:
+		return valueNode(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return valueNode(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &ast.LiteralType{
+			Token: token.Token{
+				Type: token.NUMBER,
+				Text: strconv.FormatUint(v.Uint(), 10),
+			},
+		}, true
+	case reflect.Float32, reflect.Float64:
+		return &ast.LiteralType{
+			Token: token.Token{
+				Type: token.FLOAT,
+				Text: strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()),
+			},
+		}, true
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, false
+		}
+		return reflectValueNode(v.Elem())
+	case reflect.Slice, reflect.Array:
+		lt := &ast.ListType{}
+		for i := 0; i < v.Len(); i++ {
+			entNode, ok := reflectValueNode(v.Index(i))
+			if !ok {
+				return nil, false
+			}
+			lt.Add(entNode)
 		}
+		return lt, true
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+
+		list := &ast.ObjectList{}
+		for i, k := range keys {
+			val, ok := reflectValueNode(v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key())))
+			if !ok {
+				return nil, false
+			}
+
+			item := keyItem(k, val)
+			if !isIdent(k) {
+				item.Keys[0].Token = token.Token{
+					Type: token.STRING,
+					Text: strconv.Quote(k),
+				}
+			}
+			setLine(item, i+1)
+			list.Add(item)
+		}
+		return &ast.ObjectType{List: list}, true
 	}
+	return nil, false
+}
 
-	setObjItem := &ast.ObjectItem{
+// isIdent reports whether s can be written as a bare HCL key.
+func isIdent(s string) bool {
+	for i, r := range s {
+		switch {
+		case r == '_', unicode.IsLetter(r):
+		case i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r)):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// keyItem returns the item for key = val.
+func keyItem(key string, val ast.Node) *ast.ObjectItem {
+	return &ast.ObjectItem{
 		Keys: []*ast.ObjectKey{
-			setObjKey,
+			&ast.ObjectKey{
+				Token: token.Token{
+					Type: token.IDENT,
+					Text: key,
+				},
+			},
 		},
 		Assign: token.Pos{Line: 1},
-		Val:    setNode,
+		Val:    val,
 	}
+}
 
-	setSection := &ast.ObjectItem{
+// blockItem returns an empty sub-block named name.
+func blockItem(name string) *ast.ObjectItem {
+	return &ast.ObjectItem{
 		Keys: []*ast.ObjectKey{
 			&ast.ObjectKey{
 				Token: token.Token{
 					Type: token.IDENT,
-					Text: "section",
+					Text: name,
+				},
+			},
+		},
+		Val: &ast.ObjectType{
+			List: &ast.ObjectList{},
+		},
+	}
+}
+
+// sectionItem returns the block for section "name" containing items.
+func sectionItem(name string, items ...*ast.ObjectItem) *ast.ObjectItem {
+	return labeledItem("section", name, items...)
+}
+
+// labeledItem returns the block blockType "name" containing items. An empty
+// blockType is a section.
+func labeledItem(blockType string, name string, items ...*ast.ObjectItem) *ast.ObjectItem {
+	if blockType == "" {
+		blockType = "section"
+	}
+
+	return &ast.ObjectItem{
+		Keys: []*ast.ObjectKey{
+			&ast.ObjectKey{
+				Token: token.Token{
+					Type: token.IDENT,
+					Text: blockType,
 				},
 			},
 			&ast.ObjectKey{
 				Token: token.Token{
 					Type: token.STRING,
-					Text: strconv.Quote(section),
+					Text: strconv.Quote(name),
 				},
 			},
 		},
 		Val: &ast.ObjectType{
 			List: &ast.ObjectList{
-				Items: []*ast.ObjectItem{
-					setObjItem,
-				},
+				Items: items,
 			},
 		},
 	}
-
-	for _, item := range root.Items {
-		if len(item.Keys) == 2 {
-			typeOfSection := item.Keys[0].Token.Text
-			switch typeOfSection {
-			case "section":
-				sectionName, err := getKeyAsString(item.Keys[1])
-				if err != nil {
-					return err
-				}
-
-				if sectionName != section {
-					continue
-				}
-
-				sectionFound = true
-
-				keyFound := false
-				obj := item.Val.(*ast.ObjectType)
-				for _, item := range obj.List.Items {
-					if len(item.Keys) != 1 {
-						return &parser.PosError{
-							Pos: item.Pos(),
-							Err: fmt.Errorf("expected flat keys under section %s", sectionName),
-						}
-					}
-
-					keyName, err := getKeyAsString(item.Keys[0])
-					if err != nil {
-						return err
-					}
-
-					if keyName == key {
-						keyFound = true
-						item.Val = setNode
-						break
-					}
-				}
-
-				if !keyFound {
-					obj.List.Add(setObjItem)
-				}
-			}
-		}
-	}
-
-	if !sectionFound {
-		// append new section
-		root.Add(setSection)
-	}
-
-	buf := &bytes.Buffer{}
-
-	err = printer.Fprint(buf, tree)
-	if err != nil {
-		return err
-	}
-
-	dirname := filepath.Dir(filename)
-	if _, err := os.Stat(dirname); os.IsNotExist(err) {
-		os.MkdirAll(dirname, 0755)
-	}
-
-	return ioutil.WriteFile(filename, buf.Bytes(), 0600)
 }
@@ -0,0 +1,251 @@
+package hconf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// ErrEditorClosed is returned when an Editor is used after Commit or
+// Discard.
+var ErrEditorClosed = errors.New("hconf: editor is closed")
+
+// ErrConflict is returned by Commit with Config.OptimisticEdits when the
+// file was changed by someone else after it was opened.
+var ErrConflict = errors.New("hconf: file changed since it was opened")
+
+// Editor batches changes to a configuration file. Changes are made to an
+// in-memory copy, keeping comments and formatting like EditAndSave, and the
+// file is only written by Commit.
+//
+// An Editor holds an advisory lock on the file from OpenForEdit until
+// Commit or Discard, so editors in other processes wait their turn. With
+// Config.OptimisticEdits the lock is only taken while committing, and
+// Commit fails with ErrConflict if the file changed in the meantime.
+type Editor struct {
+	hc       *HC
+	filename string
+	orig     []byte
+	data     []byte
+	exists   bool
+	crlf     bool
+	lock     *fileLock
+	closed   bool
+}
+
+// OpenForEdit reads filename for editing. A file that does not exist is
+// treated as empty and created by Commit. The Editor must be finished with
+// Commit or Discard to release its lock.
+func (hc *HC) OpenForEdit(filename string) (*Editor, error) {
+	var lock *fileLock
+	if !hc.c.OptimisticEdits {
+		var err error
+		lock, err = lockFile(filename, hc.c.LockTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	e, err := hc.readEditor(filename)
+	if err != nil {
+		if lock != nil {
+			lock.unlock()
+		}
+		return nil, err
+	}
+	e.lock = lock
+	return e, nil
+}
+
+// readEditor returns an Editor for filename without taking the lock, for
+// edits that are never committed.
+func (hc *HC) readEditor(filename string) (*Editor, error) {
+	data, exists, err := readForEdit(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	data, crlf := toLF(data)
+	_, _, err = parseRoot(data)
+	if err != nil {
+		return nil, fixupError(err, filename)
+	}
+
+	return &Editor{
+		hc:       hc,
+		filename: filename,
+		orig:     data,
+		data:     data,
+		exists:   exists,
+		crlf:     crlf,
+	}, nil
+}
+
+// toLF returns data with CRLF line endings replaced by LF, and whether it
+// had any. Edits are made on LF text, as the offsets of HCL tokens do not
+// count the CR of a CRLF line ending.
+func toLF(data []byte) ([]byte, bool) {
+	if !bytes.Contains(data, []byte("\r\n")) {
+		return data, false
+	}
+	return bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1), true
+}
+
+// content returns data with the line endings of the file.
+func (e *Editor) content(data []byte) []byte {
+	if !e.crlf {
+		return data
+	}
+	return bytes.Replace(data, []byte("\n"), []byte("\r\n"), -1)
+}
+
+func readForEdit(filename string) ([]byte, bool, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Set sets section/key to value, adding the key or section if needed. An
+// empty section sets a top level key.
+func (e *Editor) Set(section string, key string, value interface{}) error {
+	if section == "" {
+		return e.SetTopLevel(key, value)
+	}
+
+	return e.apply(func(data []byte) ([]byte, error) {
+		node, err := e.hc.editValueNode(section, key, value)
+		if err != nil {
+			return nil, err
+		}
+		return setSectionKey(data, section, key, node)
+	})
+}
+
+// SetTopLevel sets a key outside of any section.
+func (e *Editor) SetTopLevel(key string, value interface{}) error {
+	return e.apply(func(data []byte) ([]byte, error) {
+		node, err := e.hc.editValueNode("", key, value)
+		if err != nil {
+			return nil, err
+		}
+		return setTopLevelKey(data, key, node)
+	})
+}
+
+// Delete removes section/key, and the section if it is left empty. An
+// empty section deletes a top level key.
+func (e *Editor) Delete(section string, key string) error {
+	return e.apply(func(data []byte) ([]byte, error) {
+		if section == "" {
+			return deleteTopLevelKey(data, key)
+		}
+		return deleteSectionKey(data, section, key)
+	})
+}
+
+// DeleteSection removes every block for section.
+func (e *Editor) DeleteSection(section string) error {
+	return e.apply(func(data []byte) ([]byte, error) {
+		return deleteSection(data, section)
+	})
+}
+
+func (e *Editor) apply(edit func(data []byte) ([]byte, error)) error {
+	if e.closed {
+		return ErrEditorClosed
+	}
+
+	data, err := edit(e.data)
+	if err != nil {
+		return fixupError(err, e.filename)
+	}
+
+	// never leave the Editor with something Commit should not write
+	_, _, err = parseRoot(data)
+	if err != nil {
+		return fmt.Errorf("edit would leave %s unparseable: %v", e.filename, fixupError(err, e.filename))
+	}
+	e.data = data
+	return nil
+}
+
+// DryRun is the result of an edit that was not written.
+type DryRun struct {
+	// Content is what the file would contain.
+	Content []byte
+	// Diff is a unified diff from the current file to Content, or "" if
+	// nothing would change.
+	Diff string
+}
+
+// DryRun reports what Commit would write, without writing it. The Editor
+// stays open, so the changes can still be committed or discarded.
+func (e *Editor) DryRun() (*DryRun, error) {
+	if e.closed {
+		return nil, ErrEditorClosed
+	}
+
+	content := e.content(e.data)
+	return &DryRun{
+		Content: append([]byte(nil), content...),
+		Diff:    unifiedDiff(e.filename, e.content(e.orig), content),
+	}, nil
+}
+
+// Commit atomically writes every change to the file and releases the
+// lock. The file is left alone if nothing changed.
+func (e *Editor) Commit() error {
+	if e.closed {
+		return ErrEditorClosed
+	}
+	e.closed = true
+	defer e.release()
+
+	if bytes.Equal(e.data, e.orig) && (e.exists || len(e.data) == 0) {
+		return nil
+	}
+
+	if e.lock == nil {
+		lock, err := lockFile(e.filename, e.hc.c.LockTimeout)
+		if err != nil {
+			return err
+		}
+		defer lock.unlock()
+
+		current, exists, err := readForEdit(e.filename)
+		if err != nil {
+			return err
+		}
+		current, _ = toLF(current)
+		if exists != e.exists || !bytes.Equal(current, e.orig) {
+			return ErrConflict
+		}
+	}
+
+	return writeFileAtomic(e.filename, e.content(e.data))
+}
+
+// Discard drops every change and releases the lock.
+func (e *Editor) Discard() error {
+	if e.closed {
+		return ErrEditorClosed
+	}
+	e.closed = true
+	return e.release()
+}
+
+func (e *Editor) release() error {
+	if e.lock == nil {
+		return nil
+	}
+	lock := e.lock
+	e.lock = nil
+	return lock.unlock()
+}
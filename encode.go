@@ -0,0 +1,161 @@
+package hconf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/printer"
+)
+
+// Encode writes in as formatted HCL, with top level keys followed by a
+// section block for each hsection field and a block for each entry of an
+// hlabeled field. Only wrapper values whose IsSet is
+// true, and plain values that are not the zero value, are written, unless
+// Config.EncodeAll is set. Sections and sub-blocks with nothing to write
+// are left out.
+func (hc *HC) Encode(w io.Writer, in interface{}) error {
+	val := reflect.ValueOf(in)
+	if val.Kind() != reflect.Ptr {
+		return errors.New("in must be a pointer")
+	}
+
+	root := &ast.ObjectList{}
+	var sections []*ast.ObjectItem
+	blocks := make(map[string]*ast.ObjectList)
+
+	for _, kf := range hc.keyFields(val) {
+		value, ok := hc.encodeValue(kf)
+		if !ok && kf.blockType == "" {
+			continue
+		}
+
+		var list *ast.ObjectList
+		if kf.section != "" {
+			var seen bool
+			list, seen = blocks[kf.block()]
+			if !seen {
+				section := labeledItem(kf.blockType, kf.section)
+				list = section.Val.(*ast.ObjectType).List
+				blocks[kf.block()] = list
+				sections = append(sections, section)
+			}
+		}
+
+		// labeled blocks are written even when they have nothing set
+		if !ok {
+			continue
+		}
+
+		node, ok, err := hc.customNode(kf.value.Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("%s: %v", kf.path(), err)
+		}
+		if !ok {
+			node, ok = valueNode(value)
+		}
+		if !ok {
+			return fmt.Errorf("%s: cannot encode %s", kf.path(), kf.value.Type())
+		}
+
+		if kf.section == "" {
+			root.Add(keyItem(kf.key, node))
+			continue
+		}
+
+		path := kf.block()
+		for _, name := range kf.blocks {
+			path += "." + name
+			sub, ok := blocks[path]
+			if !ok {
+				block := blockItem(name)
+				list.Add(block)
+				sub = block.Val.(*ast.ObjectType).List
+				blocks[path] = sub
+			}
+			list = sub
+		}
+		list.Add(keyItem(kf.name(), node))
+	}
+
+	// The printer lays out items by their line numbers: keys on adjacent
+	// lines are aligned, and a gap of a line separates blocks.
+	line := setLines(root.Items, 1)
+	for _, section := range sections {
+		line = setLines([]*ast.ObjectItem{section}, line+1)
+		root.Add(section)
+	}
+
+	return printer.Fprint(w, &ast.File{Node: root})
+}
+
+// setLines numbers items and the contents of any blocks among them from
+// line on, returning the line after the last one.
+func setLines(items []*ast.ObjectItem, line int) int {
+	for _, item := range items {
+		setLine(item, line)
+		line++
+		if obj, ok := item.Val.(*ast.ObjectType); ok {
+			line = setLines(obj.List.Items, line)
+			obj.Rbrace.Line = line
+			line++
+		}
+	}
+	return line
+}
+
+func setLine(item *ast.ObjectItem, line int) {
+	for _, key := range item.Keys {
+		key.Token.Pos.Line = line
+	}
+}
+
+// encodeValue returns the Go value to write for kf, or false if it should
+// be left out.
+func (hc *HC) encodeValue(kf keyField) (interface{}, bool) {
+	vif := kf.value.Addr().Interface()
+	if set, ok := vif.(isSetter); ok {
+		if !set.IsSet() && !hc.c.EncodeAll {
+			return nil, false
+		}
+		return wrapperValue(vif), true
+	}
+
+	if !hc.c.EncodeAll && isZero(kf.value) {
+		return nil, false
+	}
+	return kf.value.Interface(), true
+}
+
+// wrapperValue returns the value held by one of the wrapper types.
+func wrapperValue(vif interface{}) interface{} {
+	switch v := vif.(type) {
+	case stringValuer:
+		return v.ValueString()
+	case stringSliceValuer:
+		return v.ValueStringSlice()
+	case int64SliceValuer:
+		return v.ValueInt64Slice()
+	case boolSliceValuer:
+		return v.ValueBoolSlice()
+	case float64SliceValuer:
+		return v.ValueFloat64Slice()
+	case stringMapValuer:
+		return v.ValueStringMap()
+	case int64Valuer:
+		return v.ValueInt64()
+	case boolValuer:
+		return v.ValueBool()
+	case float64Valuer:
+		return v.ValueFloat64()
+	case durationValuer:
+		return v.ValueDuration()
+	}
+	return vif
+}
+
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
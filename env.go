@@ -0,0 +1,76 @@
+package hconf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+// EnvName returns the default environment variable name for a section/key
+// pair: the prefix, section and key joined with underscores and upper cased,
+// with any other character replaced by an underscore. For example prefix
+// "APP", section "foo" and key "screensize" become APP_FOO_SCREENSIZE, and
+// the sub-block key "pool.max" in section "db" becomes APP_DB_POOL_MAX.
+func EnvName(prefix string, section string, key string) string {
+	name := section + "_" + key
+	if prefix != "" {
+		name = prefix + "_" + name
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func (hc *HC) envName(section string, key string) string {
+	if hc.c.EnvName != nil {
+		return hc.c.EnvName(hc.c.EnvPrefix, section, key)
+	}
+	return EnvName(hc.c.EnvPrefix, section, key)
+}
+
+// DecodeEnv overrides section values in out with environment variables. The
+// variable for each section/key pair is named by Config.EnvName, or EnvName
+// when that is nil, and is converted the same way as a string passed to Set.
+// The Source of an overridden value has a Filename of "env:" followed by the
+// variable name. Call it after decoding files so the environment wins.
+func (hc *HC) DecodeEnv(out interface{}) error {
+	val := reflect.ValueOf(out)
+	if val.Kind() != reflect.Ptr {
+		return errors.New("out must be a pointer")
+	}
+
+	for _, kf := range hc.keyFields(val) {
+		if kf.section == "" || kf.blockType != "" {
+			continue
+		}
+
+		name := hc.envName(kf.section, kf.key)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		vif := kf.value.Addr().Interface()
+		err := hc.setValue(vif, kf.section, kf.key, value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+
+		if ss, ok := vif.(sourceSetter); ok {
+			ss.SetSource(token.Pos{Filename: "env:" + name})
+		}
+	}
+
+	return nil
+}
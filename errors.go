@@ -0,0 +1,104 @@
+package hconf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+// Errors lists every error found while decoding when Config.AllErrors is
+// set, sorted by position.
+type Errors []*parser.PosError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		if err.Pos == (token.Pos{}) {
+			msgs = append(msgs, err.Err.Error())
+			continue
+		}
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors:\n\t%s", len(e), strings.Join(msgs, "\n\t"))
+}
+
+func (e Errors) Len() int {
+	return len(e)
+}
+
+func (e Errors) Less(i, j int) bool {
+	return posBefore(e[i].Pos, e[j].Pos)
+}
+
+func (e Errors) Swap(i, j int) {
+	e[i], e[j] = e[j], e[i]
+}
+
+func posBefore(a token.Pos, b token.Pos) bool {
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+// decodeState holds what is collected over a single call to Decode or
+// DecodeFiles.
+type decodeState struct {
+	allErrors bool
+	errs      Errors
+
+	// filename is the last file read.
+	filename string
+	// sections holds the position of the first block seen for each section.
+	sections map[string]token.Pos
+
+	// check is set when the input is only being type checked, so when
+	// conditions are not evaluated and every when block is decoded.
+	check bool
+}
+
+func (hc *HC) newDecodeState() *decodeState {
+	return &decodeState{
+		allErrors: hc.c.AllErrors,
+		sections:  make(map[string]token.Pos),
+	}
+}
+
+// sectionPos returns where section was declared, for errors about keys
+// missing from it. If it was never declared, only the filename is known.
+func (st *decodeState) sectionPos(section string) token.Pos {
+	if pos, ok := st.sections[section]; ok && section != "" {
+		return pos
+	}
+	return token.Pos{Filename: st.filename}
+}
+
+// report decides whether err stops decoding. When collecting all errors, err
+// is recorded and nil is returned so the caller moves on to the next item.
+func (st *decodeState) report(err error) error {
+	if err == nil || !st.allErrors {
+		return err
+	}
+
+	perr, ok := err.(*parser.PosError)
+	if !ok {
+		perr = &parser.PosError{Err: err}
+	}
+	st.errs = append(st.errs, perr)
+	return nil
+}
+
+// err returns the collected errors, or nil if there were none.
+func (st *decodeState) err() error {
+	if len(st.errs) == 0 {
+		return nil
+	}
+	sort.Stable(st.errs)
+	return st.errs
+}
@@ -0,0 +1,158 @@
+package hconf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultExecTimeout is used when Config.ExecTimeout is zero.
+const DefaultExecTimeout = 10 * time.Second
+
+type execResult struct {
+	out string
+	err error
+}
+
+// localExec runs command and returns its trimmed stdout. Results are cached
+// on the HC until resetExecCache is called, so a command referenced by several
+// when blocks only runs once per decode.
+func (hc *HC) localExec(command string) (string, error) {
+	hc.execMu.Lock()
+	defer hc.execMu.Unlock()
+
+	if res, ok := hc.execResults[command]; ok {
+		return res.out, res.err
+	}
+
+	out, err := hc.runCommand(command)
+	if hc.execResults == nil {
+		hc.execResults = make(map[string]execResult)
+	}
+	hc.execResults[command] = execResult{out: out, err: err}
+	return out, err
+}
+
+func (hc *HC) resetExecCache() {
+	hc.execMu.Lock()
+	hc.execResults = nil
+	hc.execMu.Unlock()
+}
+
+func (hc *HC) runCommand(command string) (string, error) {
+	var argv []string
+	if hc.c.ExecShell {
+		argv = []string{"/bin/sh", "-c", command}
+	} else {
+		var err error
+		argv, err = splitArgs(command)
+		if err != nil {
+			return "", fmt.Errorf("local_Exec(%q): %v", command, err)
+		}
+	}
+
+	if len(argv) == 0 {
+		return "", fmt.Errorf("local_Exec(%q): empty command", command)
+	}
+
+	if !hc.execAllowed(argv[0]) {
+		return "", fmt.Errorf("local_Exec(%q): command %s is not allowed", command, argv[0])
+	}
+
+	timeout := hc.c.ExecTimeout
+	if timeout == 0 {
+		timeout = DefaultExecTimeout
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := startGroup(cmd)
+	if err != nil {
+		return "", fmt.Errorf("local_Exec(%q): %v", command, err)
+	}
+
+	// Wait also waits for children of the command that keep its output
+	// open, so on timeout the whole group is killed and not waited for.
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err = <-done:
+	case <-timer.C:
+		killGroup(cmd)
+		return "", fmt.Errorf("local_Exec(%q): timed out after %s", command, timeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return "", fmt.Errorf("local_Exec(%q): %v: %s", command, err, msg)
+		}
+		return "", fmt.Errorf("local_Exec(%q): %v", command, err)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (hc *HC) execAllowed(name string) bool {
+	if hc.c.ExecAllowlist == nil {
+		return true
+	}
+	for _, allowed := range hc.c.ExecAllowlist {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// splitArgs splits a command line into arguments. Arguments are separated by
+// whitespace, and may be grouped with single or double quotes.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	cur := &bytes.Buffer{}
+	inArg := false
+	var quote rune
+
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
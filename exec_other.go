@@ -0,0 +1,18 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package hconf
+
+import (
+	"os/exec"
+)
+
+// startGroup starts cmd. Without process groups, killGroup only stops cmd
+// itself, but runCommand does not wait for its children either.
+func startGroup(cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
+func killGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,66 @@
+package hconf
+
+import (
+	"os"
+	"os/user"
+	"runtime"
+)
+
+// Facts describes the host a configuration is being decoded on. The values
+// are exposed to when expressions as os(), arch(), hostname(), env("NAME"),
+// uid() and user().
+type Facts interface {
+	OS() string
+	Arch() string
+	Hostname() string
+	Env(name string) string
+	UID() int
+	User() string
+}
+
+// HostFacts returns the Facts for the running process.
+func HostFacts() Facts {
+	return hostFacts{}
+}
+
+type hostFacts struct{}
+
+func (hostFacts) OS() string {
+	return runtime.GOOS
+}
+
+func (hostFacts) Arch() string {
+	return runtime.GOARCH
+}
+
+func (hostFacts) Hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+func (hostFacts) Env(name string) string {
+	return os.Getenv(name)
+}
+
+func (hostFacts) UID() int {
+	return os.Getuid()
+}
+
+func (hostFacts) User() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return u.Username
+}
+
+// facts returns Config.Facts, or HostFacts if it is nil.
+func (hc *HC) facts() Facts {
+	if hc.c.Facts != nil {
+		return hc.c.Facts
+	}
+	return HostFacts()
+}
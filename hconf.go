@@ -1,12 +1,19 @@
 package hconf
 
 import (
+	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
@@ -16,16 +23,106 @@ import (
 
 const tagSection = "hsection"
 const tagValue = "hconf"
+const tagDefault = "hdefault"
+const tagBlock = "hblock"
+
+var durationType = reflect.TypeOf(time.Duration(0))
 
 type HC struct {
 	c *Config
+
+	// types is a copy of c.types taken by New.
+	types map[reflect.Type]registeredType
+
+	execMu      sync.Mutex
+	execResults map[string]execResult
 }
 
+// UnknownKeyPolicy controls how decoding treats sections and keys with no
+// matching field.
+type UnknownKeyPolicy int
+
+const (
+	// UnknownKeysStrict fails decoding. This is the default.
+	UnknownKeysStrict UnknownKeyPolicy = iota
+	// UnknownKeysWarn calls Config.Warn and continues decoding.
+	UnknownKeysWarn
+	// UnknownKeysIgnore silently continues decoding.
+	UnknownKeysIgnore
+)
+
 type Config struct {
+	// Facts answers the host questions asked by when expressions. If nil,
+	// the facts of the running process are used.
+	Facts Facts
+
+	// AllErrors keeps decoding after an error in a key or section, and
+	// returns every error found as Errors once the whole input has been
+	// read. Valid keys are still decoded.
+	AllErrors bool
+
+	// UnknownKeys sets how unknown sections and keys are handled, so older
+	// binaries can read configuration written for newer ones.
+	UnknownKeys UnknownKeyPolicy
+
+	// Warn is called for each unknown section or key when UnknownKeys is
+	// UnknownKeysWarn, with its position and dotted path, such as
+	// "section.key".
+	Warn func(pos token.Pos, key string)
+
+	// EncodeAll makes Encode write every key, including those that are not
+	// set, which is useful for generating a starter configuration.
+	EncodeAll bool
+
+	// LockTimeout bounds how long editing waits for another process to
+	// release its lock on the file. Zero waits indefinitely.
+	LockTimeout time.Duration
+
+	// OptimisticEdits only locks the file while an Editor commits, and
+	// fails the commit with ErrConflict if the file changed after it was
+	// opened.
+	OptimisticEdits bool
+
+	// ExecTimeout bounds how long a local_Exec command may run. Defaults to
+	// DefaultExecTimeout.
+	ExecTimeout time.Duration
+
+	// ExecAllowlist lists the commands local_Exec may run, compared against
+	// the first argument of the command. A nil list allows any command. A
+	// shell command line can run anything, so New rejects an allowlist
+	// combined with ExecShell.
+	ExecAllowlist []string
+
+	// ExecShell runs local_Exec commands with /bin/sh -c instead of splitting
+	// them into arguments.
+	ExecShell bool
+
+	// EnvPrefix is prepended to the environment variable names read by
+	// DecodeEnv.
+	EnvPrefix string
+
+	// EnvName overrides how DecodeEnv names the environment variable for a
+	// section/key pair. If nil, EnvName is used.
+	EnvName func(prefix string, section string, key string) string
+
+	// types holds the custom value types added with RegisterType.
+	types map[reflect.Type]registeredType
 }
 
 func New(c *Config) (*HC, error) {
-	return &HC{c: c}, nil
+	if c == nil {
+		c = &Config{}
+	}
+
+	if c.ExecShell && c.ExecAllowlist != nil {
+		return nil, errors.New("hconf: ExecAllowlist cannot be used with ExecShell")
+	}
+
+	types := make(map[reflect.Type]registeredType, len(c.types))
+	for t, rt := range c.types {
+		types[t] = rt
+	}
+	return &HC{c: c, types: types}, nil
 }
 
 // Decode HC into an object
@@ -37,7 +134,46 @@ func (hc *HC) DecodeFile(out interface{}, filename string) error {
 	return hc.Decode(out, filename, data)
 }
 
-func (hc *HC) sectionFields(out reflect.Value) (map[string]reflect.Value, error) {
+// DecodeFiles decodes each file into out in order, so keys in later files
+// override the same keys in earlier files while keys they do not mention keep
+// their earlier value. The Source of each value names the file that set it.
+// Files that do not exist are skipped.
+func (hc *HC) DecodeFiles(out interface{}, filenames ...string) error {
+	hc.resetExecCache()
+	st := hc.newDecodeState()
+	for _, filename := range filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		err = hc.decode(st, out, filename, data)
+		if err != nil {
+			return fixupError(err, filename)
+		}
+	}
+	return hc.finish(st, out)
+}
+
+// DecodeGlob decodes every file matching pattern, in lexical order, as
+// layers with DecodeFiles. This is useful for conf.d style directories:
+//
+//	hc.DecodeGlob(config, "/etc/app/conf.d/*.conf")
+func (hc *HC) DecodeGlob(out interface{}, pattern string) error {
+	filenames, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	sort.Strings(filenames)
+	return hc.DecodeFiles(out, filenames...)
+}
+
+// sectionFields returns the hblock sub-blocks and hconf keys of a section,
+// or of a sub-block within one.
+func (hc *HC) sectionFields(out reflect.Value) (map[string]reflect.Value, map[string]reflect.Value, error) {
 	structType := out.Type()
 	fields := make(map[*reflect.StructField]reflect.Value)
 	for i := 0; i < structType.NumField(); i++ {
@@ -45,6 +181,7 @@ func (hc *HC) sectionFields(out reflect.Value) (map[string]reflect.Value, error)
 		fields[&fieldType] = out.Field(i)
 	}
 
+	blockFields := make(map[string]reflect.Value)
 	valueFields := make(map[string]reflect.Value)
 
 	for fieldType, field := range fields {
@@ -52,71 +189,152 @@ func (hc *HC) sectionFields(out reflect.Value) (map[string]reflect.Value, error)
 			continue
 		}
 
-		tag := fieldType.Tag.Get(tagValue)
+		tag := fieldType.Tag.Get(tagBlock)
+		if tag != "" && field.Kind() == reflect.Struct {
+			blockFields[tag] = field
+			continue
+		}
+
+		tag = fieldType.Tag.Get(tagValue)
 		if tag != "" {
 			valueFields[tag] = field
 		}
 	}
 
-	return valueFields, nil
+	return blockFields, valueFields, nil
 }
 
 // node invariants:
 //  node.Keys[0] == "section"
 //  node.Keys[1] == sectionName
-func (hc *HC) handleSection(out reflect.Value, node *ast.ObjectItem) error {
+func (hc *HC) handleSection(st *decodeState, out reflect.Value, node *ast.ObjectItem) error {
 	sectionName, err := getKeyAsString(node.Keys[1])
 	if err != nil {
 		return err
 	}
 
-	valueFields, err := hc.sectionFields(out)
+	if _, ok := st.sections[sectionName]; !ok {
+		st.sections[sectionName] = node.Keys[0].Pos()
+	}
+
+	return hc.handleBlock(st, sectionName, out, node.Val.(*ast.ObjectType))
+}
+
+// handleBlock decodes the body of a section, or of a sub-block within one,
+// into out. path is the dotted path of the block, such as "db.pool".
+func (hc *HC) handleBlock(st *decodeState, path string, out reflect.Value, obj *ast.ObjectType) error {
+	blockFields, valueFields, err := hc.sectionFields(out)
 	if err != nil {
 		return err
 	}
 
-	obj := node.Val.(*ast.ObjectType)
 	for _, item := range obj.List.Items {
-		if len(item.Keys) != 1 {
-			return &parser.PosError{
-				Pos: item.Pos(),
-				Err: fmt.Errorf("expected flat keys under section %s", sectionName),
-			}
-		}
-
-		key, err := getKeyAsString(item.Keys[0])
+		err = st.report(hc.handleSectionItem(st, path, blockFields, valueFields, item))
 		if err != nil {
 			return err
 		}
+	}
 
-		v, ok := valueFields[key]
+	return nil
+}
+
+func (hc *HC) handleSectionItem(st *decodeState, path string, blockFields map[string]reflect.Value, valueFields map[string]reflect.Value, item *ast.ObjectItem) error {
+	if len(item.Keys) != 1 {
+		return &parser.PosError{
+			Pos: item.Pos(),
+			Err: fmt.Errorf("expected flat keys under section %s", path),
+		}
+	}
+
+	key, err := getKeyAsString(item.Keys[0])
+	if err != nil {
+		return err
+	}
+
+	return hc.handleSectionKey(st, path, key, blockFields, valueFields, item)
+}
+
+// handleSectionKey decodes item, with key key, into the block at path. A
+// dotted key that is not itself a key of the block, such as "pool.max", is
+// the key max in sub-block pool, as EditAndSave writes it when the sub-block
+// does not exist yet.
+func (hc *HC) handleSectionKey(st *decodeState, path string, key string, blockFields map[string]reflect.Value, valueFields map[string]reflect.Value, item *ast.ObjectItem) error {
+	if _, ok := valueFields[key]; !ok {
+		if i := strings.Index(key, "."); i > 0 {
+			if v, ok := blockFields[key[:i]]; ok {
+				subBlockFields, subValueFields, err := hc.sectionFields(v)
+				if err != nil {
+					return err
+				}
+				return hc.handleSectionKey(st, path+"."+key[:i], key[i+1:], subBlockFields, subValueFields, item)
+			}
+		}
+	}
+
+	if v, ok := blockFields[key]; ok {
+		obj, ok := item.Val.(*ast.ObjectType)
 		if !ok {
 			return &parser.PosError{
-				Pos: item.Keys[0].Pos(),
-				Err: fmt.Errorf("unknown key: %s.%s", sectionName, key),
+				Pos: item.Val.Pos(),
+				Err: fmt.Errorf("expected block body for %s.%s", path, key),
 			}
 		}
+		return hc.handleBlock(st, path+"."+key, v, obj)
+	}
 
-		err = hc.decodeInto(key, item.Val, v)
-		if err != nil {
-			return err
-		}
-		/*
-			println("------------")
-			fmt.Printf("section.item: %s.%s\n", sectionName, key)
-			println("------------")
-		*/
+	v, ok := valueFields[key]
+	if !ok {
+		return hc.unknownKey(item.Keys[0].Pos(), path+"."+key, &parser.PosError{
+			Pos: item.Keys[0].Pos(),
+			Err: fmt.Errorf("unknown key: %s.%s", path, key),
+		})
 	}
 
-	return nil
+	return hc.decodeInto(path+"."+key, item.Val, v)
 }
 
 // node invariants:
 //  node.Keys[0] == "when"
 //  node.Keys[1] == whenConditional
-func (hc *HC) handleWhen(out interface{}, node *ast.ObjectItem) error {
-	// fmt.Printf("when: %#v\n", node)
-	return nil
+func (hc *HC) handleWhen(st *decodeState, out interface{}, node *ast.ObjectItem) error {
+	expr, err := getKeyAsString(node.Keys[1])
+	if err != nil {
+		return err
+	}
+
+	pr, err := parseExpression(expr)
+	if err != nil {
+		return &parser.PosError{
+			Pos: node.Keys[1].Pos(),
+			Err: fmt.Errorf("invalid when expression '%s': %v", expr, err),
+		}
+	}
+
+	obj, ok := node.Val.(*ast.ObjectType)
+	if !ok {
+		return &parser.PosError{
+			Pos: node.Val.Pos(),
+			Err: fmt.Errorf("expected object body for when '%s'", expr),
+		}
+	}
+
+	if st.check {
+		return hc.decodeItems(st, out, obj.List.Items)
+	}
+
+	ok, err = hc.evaluate(pr)
+	if err != nil {
+		return &parser.PosError{
+			Pos: node.Pos(),
+			Err: fmt.Errorf("when '%s': %v", expr, err),
+		}
+	}
+
+	if !ok {
+		return nil
+	}
+
+	return hc.decodeItems(st, out, obj.List.Items)
 }
 
 func getKeyAsString(objkey *ast.ObjectKey) (string, error) {
@@ -139,17 +357,61 @@ func getKeyAsString(objkey *ast.ObjectKey) (string, error) {
 }
 
 func (hc *HC) Decode(out interface{}, filename string, data []byte) error {
-	err := hc.decode(out, filename, data)
+	hc.resetExecCache()
+	st := hc.newDecodeState()
+	err := hc.decode(st, out, filename, data)
+	if err != nil {
+		return fixupError(err, filename)
+	}
+	return hc.finish(st, out)
+}
+
+// finish completes a decode once every input has been read.
+func (hc *HC) finish(st *decodeState, out interface{}) error {
+	err := hc.applyDefaults(out)
 	if err != nil {
-		switch xerr := err.(type) {
-		case *parser.PosError:
-			if xerr.Pos.Filename == "" {
-				xerr.Pos.Filename = filename
-			}
-		}
 		return err
 	}
-	return nil
+
+	err = hc.validate(st, out)
+	if err != nil {
+		return err
+	}
+	return st.err()
+}
+
+// fixupError fills in the filename of errors raised before the parsed tree
+// carried one.
+func fixupError(err error, filename string) error {
+	switch xerr := err.(type) {
+	case *parser.PosError:
+		if xerr.Pos.Filename == "" {
+			xerr.Pos.Filename = filename
+		}
+	}
+	return err
+}
+
+// setFilename records filename in every position of tree, so decoded values
+// and errors refer to the file they came from.
+func setFilename(tree *ast.File, filename string) {
+	ast.Walk(tree, func(n ast.Node) (ast.Node, bool) {
+		switch x := n.(type) {
+		case *ast.ObjectKey:
+			x.Token.Pos.Filename = filename
+		case *ast.ObjectItem:
+			x.Assign.Filename = filename
+		case *ast.LiteralType:
+			x.Token.Pos.Filename = filename
+		case *ast.ListType:
+			x.Lbrack.Filename = filename
+			x.Rbrack.Filename = filename
+		case *ast.ObjectType:
+			x.Lbrace.Filename = filename
+			x.Rbrace.Filename = filename
+		}
+		return n, true
+	})
 }
 
 func (hc *HC) fields(obj reflect.Value) (map[string]reflect.Value, map[string]reflect.Value, error) {
@@ -183,22 +445,113 @@ func (hc *HC) fields(obj reflect.Value) (map[string]reflect.Value, map[string]re
 	return sectionFields, valueFields, nil
 }
 
-func (hc *HC) decode(out interface{}, filename string, data []byte) error {
+// keyField is an hconf tagged field, either at the top level, where section
+// is empty, or within an hsection struct. Keys in sub-blocks are dotted
+// paths within the section. For a key in a labeled block, blockType is the
+// hlabeled block type and section is the label.
+type keyField struct {
+	blockType string
+	section   string
+	key       string
+	value     reflect.Value
+	field     reflect.StructField
+
+	// blocks names the sub-blocks holding the key, which key starts with.
+	// Keys may contain dots themselves, so key alone cannot tell.
+	blocks []string
+
+	// store writes value back to its map entry after it is changed, and
+	// is nil for values that are set in place.
+	store func()
+}
+
+// block returns the dotted path of the section or labeled block holding
+// the key.
+func (kf *keyField) block() string {
+	if kf.blockType == "" {
+		return kf.section
+	}
+	return kf.blockType + "." + kf.section
+}
+
+// name returns the key within its innermost sub-block.
+func (kf *keyField) name() string {
+	name := kf.key
+	for _, block := range kf.blocks {
+		name = name[len(block)+1:]
+	}
+	return name
+}
+
+func (kf *keyField) path() string {
+	if kf.section == "" {
+		return kf.key
+	}
+	return kf.block() + "." + kf.key
+}
+
+// keyFields lists the top level, section and labeled block keys of obj in
+// declaration order.
+func (hc *HC) keyFields(obj reflect.Value) []keyField {
+	var keys []keyField
+	result := obj.Elem()
+	structType := result.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		fieldType := structType.Field(i)
+		field := result.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+
+		if section := fieldType.Tag.Get(tagSection); section != "" {
+			keys = blockKeyFields(keys, section, nil, field)
+		} else if blockType := fieldType.Tag.Get(tagLabeled); blockType != "" {
+			keys = labeledKeyFields(keys, blockType, field)
+		} else if key := fieldType.Tag.Get(tagValue); key != "" {
+			keys = append(keys, keyField{key: key, value: field, field: fieldType})
+		}
+	}
+	return keys
+}
+
+// blockKeyFields appends the keys of a section or sub-block to keys. blocks
+// names the sub-blocks leading to block, which prefix each key.
+func blockKeyFields(keys []keyField, section string, blocks []string, block reflect.Value) []keyField {
+	prefix := ""
+	for _, name := range blocks {
+		prefix += name + "."
+	}
+
+	blockType := block.Type()
+	for i := 0; i < blockType.NumField(); i++ {
+		keyType := blockType.Field(i)
+		field := block.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+
+		if name := keyType.Tag.Get(tagBlock); name != "" && field.Kind() == reflect.Struct {
+			keys = blockKeyFields(keys, section, append(blocks[:len(blocks):len(blocks)], name), field)
+		} else if key := keyType.Tag.Get(tagValue); key != "" {
+			keys = append(keys, keyField{section: section, key: prefix + key, value: field, field: keyType, blocks: blocks})
+		}
+	}
+	return keys
+}
+
+func (hc *HC) decode(st *decodeState, out interface{}, filename string, data []byte) error {
 	tree, err := hcl.ParseBytes(data)
 	if err != nil {
 		return err
 	}
+	setFilename(tree, filename)
+	st.filename = filename
 
 	val := reflect.ValueOf(out)
 	if val.Kind() != reflect.Ptr {
 		return errors.New("out must be a pointer")
 	}
 
-	sectionFields, valueFields, err := hc.fields(val)
-	if err != nil {
-		return err
-	}
-
 	root, ok := tree.Node.(*ast.ObjectList)
 	if !ok {
 		return &parser.PosError{
@@ -207,93 +560,211 @@ func (hc *HC) decode(out interface{}, filename string, data []byte) error {
 		}
 	}
 
-	for _, item := range root.Items {
-		if len(item.Keys) == 1 {
-			// top level key
-			key := item.Keys[0].Token.Text
+	return hc.decodeItems(st, out, root.Items)
+}
 
-			v, ok := valueFields[key]
-			if !ok {
-				return &parser.PosError{
-					Pos: item.Keys[0].Pos(),
-					Err: fmt.Errorf("unknown key: %s", key),
-				}
-			}
+// decodeItems decodes a list of root level items (top level keys, sections
+// and when blocks) into out. It is used for both the file root and the body
+// of a matching when block.
+func (hc *HC) decodeItems(st *decodeState, out interface{}, items []*ast.ObjectItem) error {
+	sectionFields, valueFields, err := hc.fields(reflect.ValueOf(out))
+	if err != nil {
+		return err
+	}
+
+	labeledFields, err := hc.labeledFields(reflect.ValueOf(out))
+	if err != nil {
+		return err
+	}
 
-			err = hc.decodeInto(key, item.Val, v)
+	for _, item := range items {
+		err = st.report(hc.decodeItem(st, out, sectionFields, valueFields, labeledFields, item))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (hc *HC) decodeItem(st *decodeState, out interface{}, sectionFields map[string]reflect.Value, valueFields map[string]reflect.Value, labeledFields map[string]reflect.Value, item *ast.ObjectItem) error {
+	if len(item.Keys) == 1 {
+		// top level key
+		key := item.Keys[0].Token.Text
+
+		v, ok := valueFields[key]
+		if !ok {
+			return hc.unknownKey(item.Keys[0].Pos(), key, &parser.PosError{
+				Pos: item.Keys[0].Pos(),
+				Err: fmt.Errorf("unknown key: %s", key),
+			})
+		}
+
+		return hc.decodeInto(key, item.Val, v)
+	} else if len(item.Keys) == 2 {
+		typeOfSection := item.Keys[0].Token.Text
+		switch typeOfSection {
+		case "section":
+			key, err := getKeyAsString(item.Keys[1])
 			if err != nil {
 				return err
 			}
-		} else if len(item.Keys) == 2 {
-			typeOfSection := item.Keys[0].Token.Text
-			switch typeOfSection {
-			case "section":
-				key, err := getKeyAsString(item.Keys[1])
-				if err != nil {
-					return err
-				}
 
-				sectionValue, ok := sectionFields[key]
-				if !ok {
-					return &parser.PosError{
-						Pos: item.Keys[1].Pos(),
-						Err: fmt.Errorf("unknown section: %s", key),
-					}
-				}
-				err = hc.handleSection(sectionValue, item)
-				if err != nil {
-					return err
-				}
-			case "when":
-				err = hc.handleWhen(out, item)
-				if err != nil {
-					return err
-				}
-			default:
-				return &parser.PosError{
-					Pos: item.Pos(),
-					Err: fmt.Errorf("unkown section type '%s' expected 'section' or 'when'", typeOfSection),
-				}
+			sectionValue, ok := sectionFields[key]
+			if !ok {
+				return hc.unknownKey(item.Keys[1].Pos(), key, &parser.PosError{
+					Pos: item.Keys[1].Pos(),
+					Err: fmt.Errorf("unknown section: %s", key),
+				})
 			}
-		} else {
-			return &parser.PosError{
-				Pos: item.Pos(),
-				Err: fmt.Errorf("invalid config: expected: section, when, or top level key: %#v", item),
+			return hc.handleSection(st, sectionValue, item)
+		case "when":
+			return hc.handleWhen(st, out, item)
+		default:
+			if field, ok := labeledFields[typeOfSection]; ok {
+				return hc.handleLabeled(st, typeOfSection, field, item)
+			}
+
+			label, err := getKeyAsString(item.Keys[1])
+			if err != nil {
+				return err
 			}
+			return hc.unknownKey(item.Pos(), typeOfSection+"."+label, &parser.PosError{
+				Pos: item.Pos(),
+				Err: fmt.Errorf("unkown section type '%s' expected 'section' or 'when'", typeOfSection),
+			})
 		}
 	}
 
-	return nil
+	names := make([]string, 0, len(item.Keys))
+	for _, k := range item.Keys {
+		name, err := getKeyAsString(k)
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	return hc.unknownKey(item.Pos(), strings.Join(names, "."), &parser.PosError{
+		Pos: item.Pos(),
+		Err: fmt.Errorf("invalid config: expected: section, when, or top level key: %s", strings.Join(names, " ")),
+	})
 }
 
-// Set a specific value from a section/key pair
+// unknownKey applies the UnknownKeys policy to an unknown section or key
+// at pos, returning err only when decoding should fail.
+func (hc *HC) unknownKey(pos token.Pos, key string, err error) error {
+	switch hc.c.UnknownKeys {
+	case UnknownKeysWarn:
+		if hc.c.Warn != nil {
+			hc.c.Warn(pos, key)
+		}
+		return nil
+	case UnknownKeysIgnore:
+		return nil
+	}
+	return err
+}
+
+// Set a specific value from a section/key pair. An empty section refers to
+// a top level key, and a key in a sub-block is a dotted path within its
+// section, such as "pool.max" in section "db".
 func (hc *HC) Set(input interface{}, section string, key string, value interface{}) error {
+	v, err := hc.lookup(input, section, key)
+	if err != nil {
+		return err
+	}
+
+	return hc.setValue(v.Addr().Interface(), section, key, value)
+}
+
+// lookup finds the field for a section/key pair, or a top level key when
+// section is empty. Keys in sub-blocks are dotted paths within the section.
+func (hc *HC) lookup(input interface{}, section string, key string) (reflect.Value, error) {
 	val := reflect.ValueOf(input)
 	if val.Kind() != reflect.Ptr {
-		return errors.New("out must be a pointer")
+		return reflect.Value{}, errors.New("out must be a pointer")
 	}
 
-	sectionFields, _, err := hc.fields(val)
+	sectionFields, topFields, err := hc.fields(val)
 	if err != nil {
-		return err
+		return reflect.Value{}, err
+	}
+
+	if section == "" {
+		v, ok := topFields[key]
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown key: %s", key)
+		}
+		return v, nil
 	}
 
 	sectionValue, ok := sectionFields[section]
 	if !ok {
-		return fmt.Errorf("unknown section: %s", section)
+		return reflect.Value{}, fmt.Errorf("unknown section: %s", section)
 	}
 
-	valueFields, err := hc.sectionFields(sectionValue)
-	if err != nil {
-		return err
+	// key is a dotted path through any sub-blocks, such as "pool.max", but
+	// keys may contain dots themselves, so the rest of the path is tried as
+	// a key before it is split
+	v := sectionValue
+	rest := key
+	for {
+		blockFields, valueFields, err := hc.sectionFields(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		if f, ok := valueFields[rest]; ok {
+			return f, nil
+		}
+
+		i := strings.Index(rest, ".")
+		if i < 0 {
+			return reflect.Value{}, fmt.Errorf("unknown key: %s in section %s", key, section)
+		}
+
+		v, ok = blockFields[rest[:i]]
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown block: %s in section %s", key[:len(key)-len(rest)+i], section)
+		}
+		rest = rest[i+1:]
 	}
+}
 
-	v, ok := valueFields[key]
-	if !ok {
-		return fmt.Errorf("unknown key: %s in section %s", key, section)
+// setValue converts value to the wrapper type of vif and sets it. Strings
+// are parsed as needed, so values from the command line or environment can
+// be applied to any wrapper type. Custom types are given value as a
+// literal.
+func (hc *HC) setValue(vif interface{}, section string, key string, value interface{}) error {
+	if elem := reflect.ValueOf(vif).Elem(); hc.isCustom(elem) {
+		node, ok, err := hc.customNode(value)
+		if err != nil {
+			return fmt.Errorf("'%s.%s': %v", section, key, err)
+		}
+		if !ok {
+			node, ok = valueNode(value)
+		}
+		if !ok {
+			return fmt.Errorf("'%s.%s': cannot set %s from %T", section, key, elem.Type(), value)
+		}
+
+		err = hc.unmarshalCustom(node, token.Pos{}, elem)
+		if err != nil {
+			return fmt.Errorf("'%s.%s': %v", section, key, err)
+		}
+		return nil
 	}
 
-	vif := v.Addr().Interface()
+	if _, ok := vif.(isSetter); !ok {
+		ok, err := setPlain(reflect.ValueOf(vif).Elem(), value)
+		if err != nil {
+			return fmt.Errorf("'%s.%s': %v", section, key, err)
+		}
+		if ok {
+			return nil
+		}
+		return fmt.Errorf("unknown key: %s.%s is %T, not known type, failed to set to from '%v'", key, section, vif, value)
+	}
 
 	switch v := value.(type) {
 	case string:
@@ -313,6 +784,33 @@ func (hc *HC) Set(input interface{}, section string, key string, value interface
 			return fmt.Errorf("key: %s.%s failed to set bool from string: '%s'", key, section, v)
 		}
 
+		if is, ok := vif.(int64Setter); ok {
+			i, err := strconv.ParseInt(v, 0, 64)
+			if err != nil {
+				return fmt.Errorf("'%s.%s' must be an integer", section, key)
+			}
+			is.SetValue(i)
+			return nil
+		}
+
+		if fs, ok := vif.(float64Setter); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("'%s.%s' must be a number", section, key)
+			}
+			fs.SetValue(f)
+			return nil
+		}
+
+		if ds, ok := vif.(durationSetter); ok {
+			d, err := parseDuration(v)
+			if err != nil {
+				return fmt.Errorf("'%s.%s' must be a duration", section, key)
+			}
+			ds.SetValue(d)
+			return nil
+		}
+
 		if bs, ok := vif.(stringSliceSetter); ok {
 			ss := value.(string)
 			x := []string{}
@@ -324,7 +822,52 @@ func (hc *HC) Set(input interface{}, section string, key string, value interface
 			return nil
 		}
 
+		if is, ok := vif.(int64SliceSetter); ok {
+			x := []int64{}
+			err := json.Unmarshal([]byte(v), &x)
+			if err != nil {
+				return fmt.Errorf("'%s.%s' must be a list of integers", section, key)
+			}
+			is.SetValue(x)
+			return nil
+		}
+
+		if bs, ok := vif.(boolSliceSetter); ok {
+			x := []bool{}
+			err := json.Unmarshal([]byte(v), &x)
+			if err != nil {
+				return fmt.Errorf("'%s.%s' must be a list of bools", section, key)
+			}
+			bs.SetValue(x)
+			return nil
+		}
+
+		if fs, ok := vif.(float64SliceSetter); ok {
+			x := []float64{}
+			err := json.Unmarshal([]byte(v), &x)
+			if err != nil {
+				return fmt.Errorf("'%s.%s' must be a list of numbers", section, key)
+			}
+			fs.SetValue(x)
+			return nil
+		}
+
+		if ms, ok := vif.(stringMapSetter); ok {
+			x := map[string]string{}
+			err := json.Unmarshal([]byte(v), &x)
+			if err != nil {
+				return fmt.Errorf("'%s.%s' must be an object of strings", section, key)
+			}
+			ms.SetValue(x)
+			return nil
+		}
+
 		return fmt.Errorf("key: %s.%s failed to set from string", key, section)
+	case int:
+		if is, ok := vif.(int64Setter); ok {
+			is.SetValue(int64(v))
+			return nil
+		}
 	case int32:
 		if is, ok := vif.(int64Setter); ok {
 			is.SetValue(int64(v))
@@ -335,6 +878,16 @@ func (hc *HC) Set(input interface{}, section string, key string, value interface
 			is.SetValue(v)
 			return nil
 		}
+	case float64:
+		if fs, ok := vif.(float64Setter); ok {
+			fs.SetValue(v)
+			return nil
+		}
+	case time.Duration:
+		if ds, ok := vif.(durationSetter); ok {
+			ds.SetValue(v)
+			return nil
+		}
 	case bool:
 		if bs, ok := vif.(boolSetter); ok {
 			bs.SetValue(v)
@@ -345,37 +898,220 @@ func (hc *HC) Set(input interface{}, section string, key string, value interface
 			bs.SetValue(v)
 			return nil
 		}
+	case []int64:
+		if is, ok := vif.(int64SliceSetter); ok {
+			is.SetValue(v)
+			return nil
+		}
+	case []bool:
+		if bs, ok := vif.(boolSliceSetter); ok {
+			bs.SetValue(v)
+			return nil
+		}
+	case []float64:
+		if fs, ok := vif.(float64SliceSetter); ok {
+			fs.SetValue(v)
+			return nil
+		}
+	case map[string]string:
+		if ms, ok := vif.(stringMapSetter); ok {
+			ms.SetValue(v)
+			return nil
+		}
 	}
 
 	return fmt.Errorf("unknown key: %s.%s is %T, not known type, failed to set to from '%v'", key, section, vif, vif)
 }
 
-// Get a specific value from a section/key pair
-func (hc *HC) Get(input interface{}, section string, key string) (interface{}, token.Pos, error) {
-	pos := token.Pos{}
-	val := reflect.ValueOf(input)
-	if val.Kind() != reflect.Ptr {
-		return nil, pos, errors.New("out must be a pointer")
+// setPlain sets a field of a plain Go type, such as a string, uint or
+// []string, from a value of a convertible type or by parsing a string. Lists
+// and maps are parsed from JSON, element by element, and types implementing
+// encoding.TextUnmarshaler from their text. It returns false if the field's
+// type is not supported.
+func setPlain(field reflect.Value, value interface{}) (bool, error) {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return false, fmt.Errorf("cannot set %s from nil", field.Type())
 	}
 
-	sectionFields, _, err := hc.fields(val)
-	if err != nil {
-		return nil, pos, err
+	if v.Type().AssignableTo(field.Type()) {
+		field.Set(v)
+		return true, nil
 	}
 
-	sectionValue, ok := sectionFields[section]
-	if !ok {
-		return nil, pos, fmt.Errorf("unknown section: %s", section)
+	s, isString := value.(string)
+	if isString {
+		if field.Type() == durationType {
+			d, err := parseDuration(s)
+			if err != nil {
+				return false, err
+			}
+			field.SetInt(int64(d))
+			return true, nil
+		}
+
+		if tu, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			err := tu.UnmarshalText([]byte(s))
+			if err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		if isString {
+			field.SetString(s)
+			return true, nil
+		}
+	case reflect.Bool:
+		if isString {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return false, err
+			}
+			field.SetBool(b)
+			return true, nil
+		}
+		if v.Kind() == reflect.Bool {
+			field.SetBool(v.Bool())
+			return true, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if isString {
+			i, err := strconv.ParseInt(s, 0, field.Type().Bits())
+			if err != nil {
+				return false, err
+			}
+			field.SetInt(i)
+			return true, nil
+		}
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if field.OverflowInt(v.Int()) {
+				return false, fmt.Errorf("%d overflows %s", v.Int(), field.Type())
+			}
+			field.SetInt(v.Int())
+			return true, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if isString {
+			f, err := strconv.ParseFloat(s, field.Type().Bits())
+			if err != nil {
+				return false, err
+			}
+			field.SetFloat(f)
+			return true, nil
+		}
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			field.SetFloat(v.Float())
+			return true, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if isString {
+			u, err := strconv.ParseUint(s, 0, field.Type().Bits())
+			if err != nil {
+				return false, err
+			}
+			field.SetUint(u)
+			return true, nil
+		}
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.Int() < 0 || field.OverflowUint(uint64(v.Int())) {
+				return false, fmt.Errorf("%d overflows %s", v.Int(), field.Type())
+			}
+			field.SetUint(uint64(v.Int()))
+			return true, nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if field.OverflowUint(v.Uint()) {
+				return false, fmt.Errorf("%d overflows %s", v.Uint(), field.Type())
+			}
+			field.SetUint(v.Uint())
+			return true, nil
+		}
+	case reflect.Slice, reflect.Map:
+		if isString {
+			return setPlainJSON(field, s)
+		}
+		if v.Type().ConvertibleTo(field.Type()) {
+			field.Set(v.Convert(field.Type()))
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// setPlainJSON sets a slice or map field from s, a JSON list or object like
+// the wrapper types take. Each element is set by setPlain from its JSON
+// text, so elements follow the same rules as scalar fields: durations are
+// parsed as durations, and TextUnmarshalers from their text.
+func setPlainJSON(field reflect.Value, s string) (bool, error) {
+	elemType := field.Type().Elem()
+	setElem := func(elem reflect.Value, raw json.RawMessage) (bool, error) {
+		text := string(raw)
+		if len(raw) > 0 && raw[0] == '"' {
+			err := json.Unmarshal(raw, &text)
+			if err != nil {
+				return false, err
+			}
+		} else if text == "null" {
+			return true, nil
+		}
+		return setPlain(elem, text)
+	}
+
+	if field.Kind() == reflect.Map {
+		if field.Type().Key().Kind() != reflect.String {
+			return false, nil
+		}
+
+		var entries map[string]json.RawMessage
+		err := json.Unmarshal([]byte(s), &entries)
+		if err != nil {
+			return false, err
+		}
+
+		m := reflect.MakeMap(field.Type())
+		for k, raw := range entries {
+			elem := reflect.New(elemType).Elem()
+			ok, err := setElem(elem, raw)
+			if !ok || err != nil {
+				return ok, err
+			}
+			m.SetMapIndex(reflect.ValueOf(k).Convert(field.Type().Key()), elem)
+		}
+		field.Set(m)
+		return true, nil
 	}
 
-	valueFields, err := hc.sectionFields(sectionValue)
+	var entries []json.RawMessage
+	err := json.Unmarshal([]byte(s), &entries)
 	if err != nil {
-		return nil, pos, err
+		return false, err
 	}
 
-	v, ok := valueFields[key]
-	if !ok {
-		return nil, pos, fmt.Errorf("unknown key: %s in section %s", key, section)
+	list := reflect.MakeSlice(field.Type(), len(entries), len(entries))
+	for i, raw := range entries {
+		ok, err := setElem(list.Index(i), raw)
+		if !ok || err != nil {
+			return ok, err
+		}
+	}
+	field.Set(list)
+	return true, nil
+}
+
+// Get a specific value from a section/key pair. An empty section refers to
+// a top level key.
+func (hc *HC) Get(input interface{}, section string, key string) (interface{}, token.Pos, error) {
+	pos := token.Pos{}
+	v, err := hc.lookup(input, section, key)
+	if err != nil {
+		return nil, pos, err
 	}
 
 	vif := v.Addr().Interface()
@@ -385,19 +1121,55 @@ func (hc *HC) Get(input interface{}, section string, key string) (interface{}, t
 	return vif, pos, nil
 }
 
+// decodeInto decodes node into result, which is a custom type, one of the
+// wrapper types, a time.Duration, an encoding.TextUnmarshaler, or a plain Go
+// value of a scalar kind or a slice, map or pointer of those.
 func (hc *HC) decodeInto(name string, node ast.Node, result reflect.Value) error {
+	if hc.isCustom(result) {
+		err := hc.unmarshalCustom(node, node.Pos(), result)
+		if _, ok := err.(*parser.PosError); err != nil && !ok {
+			err = &parser.PosError{
+				Pos: node.Pos(),
+				Err: fmt.Errorf("%s: %v", name, err),
+			}
+		}
+		return err
+	}
+
+	if result.Type() == durationType {
+		return hc.decodeDuration(name, node, result)
+	}
+
+	if result.Kind() != reflect.Ptr && result.CanAddr() {
+		if tu, ok := result.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return hc.decodeText(name, node, tu)
+		}
+	}
+
 	var err error
 	switch result.Kind() {
 	case reflect.Bool:
 		err = hc.decodeBool(name, node, result)
-	case reflect.Float64:
+	case reflect.Float32, reflect.Float64:
 		err = hc.decodeFloat(name, node, result)
-	case reflect.Int:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		err = hc.decodeInt(name, node, result)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		err = hc.decodeUint(name, node, result)
 	case reflect.Ptr:
 		err = hc.decodePtr(name, node, result)
 	case reflect.String:
 		err = hc.decodeString(name, node, result)
+	case reflect.Slice:
+		err = hc.decodeList(name, node, result, hc.decodeInto)
+	case reflect.Map:
+		if result.Type().Key().Kind() != reflect.String {
+			return &parser.PosError{
+				Pos: node.Pos(),
+				Err: fmt.Errorf("%s: map keys must be strings, not %s", name, result.Type().Key()),
+			}
+		}
+		_, err = hc.decodeMap(name, node, result, hc.decodeInto)
 	case reflect.Struct:
 		if ss, ok := result.Addr().Interface().(stringSetter); ok {
 			var v string
@@ -431,6 +1203,62 @@ func (hc *HC) decodeInto(name string, node ast.Node, result reflect.Value) error
 				return err
 			}
 			bs.SetValue(out)
+		} else if is, ok := result.Addr().Interface().(int64SliceSetter); ok {
+			var out []int64
+			rv := reflect.Indirect(reflect.ValueOf(&out))
+			err = hc.decodeList(name, node, rv, hc.decodeInt)
+			if err != nil {
+				return err
+			}
+			is.SetValue(out)
+		} else if bs, ok := result.Addr().Interface().(boolSliceSetter); ok {
+			var out []bool
+			rv := reflect.Indirect(reflect.ValueOf(&out))
+			err = hc.decodeList(name, node, rv, hc.decodeBool)
+			if err != nil {
+				return err
+			}
+			bs.SetValue(out)
+		} else if fs, ok := result.Addr().Interface().(float64SliceSetter); ok {
+			var out []float64
+			rv := reflect.Indirect(reflect.ValueOf(&out))
+			err = hc.decodeList(name, node, rv, hc.decodeFloat)
+			if err != nil {
+				return err
+			}
+			fs.SetValue(out)
+		} else if ms, ok := result.Addr().Interface().(stringMapSetter); ok {
+			var out map[string]string
+			rv := reflect.Indirect(reflect.ValueOf(&out))
+			sources, err := hc.decodeMap(name, node, rv, hc.decodeString)
+			if err != nil {
+				return err
+			}
+			ms.SetValue(out)
+			if es, ok := ms.(entrySourceSetter); ok {
+				es.setEntrySources(sources)
+			}
+		} else if fs, ok := result.Addr().Interface().(float64Setter); ok {
+			var f float64
+			rv := reflect.Indirect(reflect.ValueOf(&f))
+			err = hc.decodeFloat(name, node, rv)
+			if err != nil {
+				return err
+			}
+			fs.SetValue(f)
+		} else if ds, ok := result.Addr().Interface().(durationSetter); ok {
+			var d time.Duration
+			rv := reflect.Indirect(reflect.ValueOf(&d))
+			err = hc.decodeDuration(name, node, rv)
+			if err != nil {
+				return err
+			}
+			ds.SetValue(d)
+		} else {
+			return &parser.PosError{
+				Pos: node.Pos(),
+				Err: fmt.Errorf("%s: cannot decode into %s", name, result.Type()),
+			}
 		}
 
 		if ss, ok := result.Addr().Interface().(sourceSetter); ok {
@@ -456,19 +1284,25 @@ func (hc *HC) decodeBool(name string, node ast.Node, result reflect.Value) error
 		if n.Token.Type == token.BOOL || n.Token.Type == token.STRING {
 			v, err := strconv.ParseBool(n.Token.Text)
 			if err != nil {
-				return err
+				return &parser.PosError{
+					Pos: node.Pos(),
+					Err: fmt.Errorf("%s: %v", name, err),
+				}
 			}
 
-			result.Set(reflect.ValueOf(v))
+			result.SetBool(v)
 			return nil
 		}
 		if n.Token.Type == token.STRING {
 			v, err := strconv.ParseBool(n.Token.Value().(string))
 			if err != nil {
-				return err
+				return &parser.PosError{
+					Pos: node.Pos(),
+					Err: fmt.Errorf("%s: %v", name, err),
+				}
 			}
 
-			result.Set(reflect.ValueOf(v))
+			result.SetBool(v)
 			return nil
 		}
 	}
@@ -482,13 +1316,28 @@ func (hc *HC) decodeBool(name string, node ast.Node, result reflect.Value) error
 func (hc *HC) decodeFloat(name string, node ast.Node, result reflect.Value) error {
 	switch n := node.(type) {
 	case *ast.LiteralType:
-		if n.Token.Type == token.FLOAT {
-			v, err := strconv.ParseFloat(n.Token.Text, 64)
+		switch n.Token.Type {
+		case token.FLOAT, token.NUMBER:
+			v, err := strconv.ParseFloat(n.Token.Text, result.Type().Bits())
 			if err != nil {
-				return err
+				return &parser.PosError{
+					Pos: node.Pos(),
+					Err: fmt.Errorf("%s: %v", name, err),
+				}
+			}
+
+			result.SetFloat(v)
+			return nil
+		case token.STRING:
+			v, err := strconv.ParseFloat(n.Token.Value().(string), result.Type().Bits())
+			if err != nil {
+				return &parser.PosError{
+					Pos: node.Pos(),
+					Err: fmt.Errorf("%s: %v", name, err),
+				}
 			}
 
-			result.Set(reflect.ValueOf(v))
+			result.SetFloat(v)
 			return nil
 		}
 	}
@@ -504,20 +1353,61 @@ func (hc *HC) decodeInt(name string, node ast.Node, result reflect.Value) error
 	case *ast.LiteralType:
 		switch n.Token.Type {
 		case token.NUMBER:
-			v, err := strconv.ParseInt(n.Token.Text, 0, 0)
+			v, err := strconv.ParseInt(n.Token.Text, 0, result.Type().Bits())
 			if err != nil {
-				return err
+				return &parser.PosError{
+					Pos: node.Pos(),
+					Err: fmt.Errorf("%s: %v", name, err),
+				}
 			}
 
-			result.Set(reflect.ValueOf(int64(v)))
+			result.SetInt(v)
 			return nil
 		case token.STRING:
-			v, err := strconv.ParseInt(n.Token.Value().(string), 0, 0)
+			v, err := strconv.ParseInt(n.Token.Value().(string), 0, result.Type().Bits())
 			if err != nil {
-				return err
+				return &parser.PosError{
+					Pos: node.Pos(),
+					Err: fmt.Errorf("%s: %v", name, err),
+				}
+			}
+
+			result.SetInt(v)
+			return nil
+		}
+	}
+
+	return &parser.PosError{
+		Pos: node.Pos(),
+		Err: fmt.Errorf("%s: unknown type %T", name, node),
+	}
+}
+
+func (hc *HC) decodeUint(name string, node ast.Node, result reflect.Value) error {
+	switch n := node.(type) {
+	case *ast.LiteralType:
+		switch n.Token.Type {
+		case token.NUMBER:
+			v, err := strconv.ParseUint(n.Token.Text, 0, result.Type().Bits())
+			if err != nil {
+				return &parser.PosError{
+					Pos: node.Pos(),
+					Err: fmt.Errorf("%s: %v", name, err),
+				}
+			}
+
+			result.SetUint(v)
+			return nil
+		case token.STRING:
+			v, err := strconv.ParseUint(n.Token.Value().(string), 0, result.Type().Bits())
+			if err != nil {
+				return &parser.PosError{
+					Pos: node.Pos(),
+					Err: fmt.Errorf("%s: %v", name, err),
+				}
 			}
 
-			result.Set(reflect.ValueOf(int64(v)))
+			result.SetUint(v)
 			return nil
 		}
 	}
@@ -528,6 +1418,69 @@ func (hc *HC) decodeInt(name string, node ast.Node, result reflect.Value) error
 	}
 }
 
+// decodeText decodes a string into a type implementing
+// encoding.TextUnmarshaler.
+func (hc *HC) decodeText(name string, node ast.Node, tu encoding.TextUnmarshaler) error {
+	var v string
+	err := hc.decodeString(name, node, reflect.Indirect(reflect.ValueOf(&v)))
+	if err != nil {
+		return err
+	}
+
+	err = tu.UnmarshalText([]byte(v))
+	if err != nil {
+		return &parser.PosError{
+			Pos: node.Pos(),
+			Err: fmt.Errorf("%s: %v", name, err),
+		}
+	}
+	return nil
+}
+
+func (hc *HC) decodeDuration(name string, node ast.Node, result reflect.Value) error {
+	switch n := node.(type) {
+	case *ast.LiteralType:
+		switch n.Token.Type {
+		case token.NUMBER:
+			v, err := strconv.ParseInt(n.Token.Text, 0, 64)
+			if err != nil {
+				return &parser.PosError{
+					Pos: node.Pos(),
+					Err: fmt.Errorf("%s: %v", name, err),
+				}
+			}
+
+			result.SetInt(int64(time.Duration(v) * time.Second))
+			return nil
+		case token.STRING:
+			v, err := parseDuration(n.Token.Value().(string))
+			if err != nil {
+				return &parser.PosError{
+					Pos: node.Pos(),
+					Err: fmt.Errorf("%s: %v", name, err),
+				}
+			}
+
+			result.SetInt(int64(v))
+			return nil
+		}
+	}
+
+	return &parser.PosError{
+		Pos: node.Pos(),
+		Err: fmt.Errorf("%s: unknown type for duration %T", name, node),
+	}
+}
+
+// parseDuration parses a Go duration string such as "1m30s", or a bare
+// integer number of seconds.
+func parseDuration(s string) (time.Duration, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(i) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
 func (hc *HC) decodeString(name string, node ast.Node, result reflect.Value) error {
 	switch n := node.(type) {
 	case *ast.LiteralType:
@@ -559,13 +1512,13 @@ func (hc *HC) decodeStringSlice(name string, node ast.Node, result reflect.Value
 					rv = append(rv, lit.Token.Value().(string))
 				default:
 					return &parser.PosError{
-						Pos: node.Pos(),
+						Pos: ent.Pos(),
 						Err: fmt.Errorf("%s[%d]: unknown entry type for string slice %T", name, i, lit),
 					}
 				}
 			default:
 				return &parser.PosError{
-					Pos: node.Pos(),
+					Pos: ent.Pos(),
 					Err: fmt.Errorf("%s[%d]: unknown entry for string slice %T", name, i, ent),
 				}
 			}
@@ -580,6 +1533,67 @@ func (hc *HC) decodeStringSlice(name string, node ast.Node, result reflect.Value
 	}
 }
 
+// decodeList decodes a list into the slice result, using decodeElem for
+// each entry. Errors name the index of the bad entry and point at it.
+func (hc *HC) decodeList(name string, node ast.Node, result reflect.Value, decodeElem func(name string, node ast.Node, result reflect.Value) error) error {
+	list, ok := node.(*ast.ListType)
+	if !ok {
+		return &parser.PosError{
+			Pos: node.Pos(),
+			Err: fmt.Errorf("%s: unknown type for list %T", name, node),
+		}
+	}
+
+	rv := reflect.MakeSlice(result.Type(), len(list.List), len(list.List))
+	for i, ent := range list.List {
+		err := decodeElem(fmt.Sprintf("%s[%d]", name, i), ent, rv.Index(i))
+		if err != nil {
+			return err
+		}
+	}
+	result.Set(rv)
+	return nil
+}
+
+// decodeMap decodes an object into the map result, using decodeElem for
+// each value, and returns the position of each entry.
+func (hc *HC) decodeMap(name string, node ast.Node, result reflect.Value, decodeElem func(name string, node ast.Node, result reflect.Value) error) (map[string]token.Pos, error) {
+	obj, ok := node.(*ast.ObjectType)
+	if !ok {
+		return nil, &parser.PosError{
+			Pos: node.Pos(),
+			Err: fmt.Errorf("%s: unknown type for map %T", name, node),
+		}
+	}
+
+	rv := reflect.MakeMapWithSize(result.Type(), len(obj.List.Items))
+	sources := make(map[string]token.Pos, len(obj.List.Items))
+	for _, item := range obj.List.Items {
+		if len(item.Keys) != 1 {
+			return nil, &parser.PosError{
+				Pos: item.Pos(),
+				Err: fmt.Errorf("%s: expected flat keys in map", name),
+			}
+		}
+
+		key, err := getKeyAsString(item.Keys[0])
+		if err != nil {
+			return nil, err
+		}
+
+		v := reflect.New(result.Type().Elem()).Elem()
+		err = decodeElem(name+"."+key, item.Val, v)
+		if err != nil {
+			return nil, err
+		}
+
+		rv.SetMapIndex(reflect.ValueOf(key).Convert(result.Type().Key()), v)
+		sources[key] = item.Keys[0].Pos()
+	}
+	result.Set(rv)
+	return sources, nil
+}
+
 func (hc *HC) decodePtr(name string, node ast.Node, result reflect.Value) error {
 	// Create an element of the concrete (non pointer) type and decode
 	// into that. Then set the value of the pointer to this type.
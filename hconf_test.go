@@ -1,11 +1,20 @@
 package hconf
 
 import (
+	"bytes"
+	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
 	"github.com/stretchr/testify/require"
 )
 
@@ -16,10 +25,18 @@ type foo struct {
 	Friends    StringSlice `hconf:"friends"`
 }
 
+type netConf struct {
+	Timeout Duration `hconf:"timeout"`
+	Backoff Duration `hconf:"backoff"`
+	Ratio   Float64  `hconf:"ratio"`
+	Scale   Float64  `hconf:"scale"`
+}
+
 type myConf struct {
-	Version string `hconf:"version"`
-	Foo     foo    `hsection:"foo"`
-	Bar     foo    `hsection:"bar"`
+	Version string  `hconf:"version"`
+	Foo     foo     `hsection:"foo"`
+	Bar     foo     `hsection:"bar"`
+	Net     netConf `hsection:"net"`
 }
 
 const conf = `
@@ -60,7 +77,7 @@ func TestBasicSection(t *testing.T) {
 	require.Equal(t, "alice", out.Foo.Friends.Value()[0])
 	require.Equal(t, "bob", out.Foo.Friends.Value()[1])
 
-	h, err := parseExpression(`local_Exec("test") == "test"`)
+	h, err := parseExpression(`local_Exec("echo test") == "test"`)
 	require.NoError(t, err)
 	require.Equal(t, h(hc), true)
 }
@@ -163,3 +180,2134 @@ func TestEditNewSection(t *testing.T) {
 	require.Len(t, c.Foo.Friends.Value(), 1)
 	require.Equal(t, "bob", c.Foo.Friends.Value()[0])
 }
+
+const confWhen = `
+version = "1"
+
+section "foo" {
+	screensize = "small"
+}
+
+when "local_Exec(\"echo prod\") == \"prod\"" {
+	version = "2"
+
+	section "foo" {
+		screensize = "large"
+	}
+}
+
+when "local_Exec(\"echo prod\") == \"dev\"" {
+	section "foo" {
+		likes_cats = true
+	}
+}
+`
+
+func TestWhen(t *testing.T) {
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	out := &myConf{}
+	err = hc.Decode(out, "foo.conf", []byte(confWhen))
+	require.NoError(t, err)
+	require.Equal(t, "2", out.Version)
+	require.Equal(t, "large", out.Foo.Screensize.Value())
+	require.False(t, out.Foo.LikesCats.IsSet())
+}
+
+func TestWhenInvalidExpression(t *testing.T) {
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	out := &myConf{}
+	err = hc.Decode(out, "foo.conf", []byte(`when "nope(" { version = "2" }`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:1")
+}
+
+type fakeFacts struct {
+	os  string
+	env map[string]string
+	uid int
+}
+
+func (f *fakeFacts) OS() string             { return f.os }
+func (f *fakeFacts) Arch() string           { return "amd64" }
+func (f *fakeFacts) Hostname() string       { return "web1" }
+func (f *fakeFacts) Env(name string) string { return f.env[name] }
+func (f *fakeFacts) UID() int               { return f.uid }
+func (f *fakeFacts) User() string           { return "alice" }
+
+const confFacts = `
+when "os() == \"linux\" && env(\"STAGE\") == \"prod\"" {
+	section "foo" {
+		screensize = "prod"
+	}
+}
+
+when "uid() == 0 || !(user() == \"alice\")" {
+	section "foo" {
+		likes_cats = true
+	}
+}
+
+when "hostname() == \"web1\" && arch() != \"arm\"" {
+	section "foo" {
+		likes_dogs = true
+	}
+}
+`
+
+func TestWhenFacts(t *testing.T) {
+	facts := &fakeFacts{
+		os:  "linux",
+		env: map[string]string{"STAGE": "prod"},
+		uid: 1000,
+	}
+	hc, err := New(&Config{Facts: facts})
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	out := &myConf{}
+	err = hc.Decode(out, "foo.conf", []byte(confFacts))
+	require.NoError(t, err)
+	require.Equal(t, "prod", out.Foo.Screensize.Value())
+	require.False(t, out.Foo.LikesCats.IsSet())
+	require.True(t, out.Foo.LikesDogs.Value())
+
+	facts.os = "darwin"
+	facts.uid = 0
+	out = &myConf{}
+	err = hc.Decode(out, "foo.conf", []byte(confFacts))
+	require.NoError(t, err)
+	require.False(t, out.Foo.Screensize.IsSet())
+	require.True(t, out.Foo.LikesCats.Value())
+}
+
+func TestWhenExec(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(&Config{ExecShell: true})
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	counter := filepath.Join(d, "counter")
+	expr := fmt.Sprintf(`local_Exec(%q) == "role-web"`, "echo x >> "+counter+"; echo role-web")
+	data := fmt.Sprintf(`
+when %[1]q {
+	section "foo" {
+		likes_cats = true
+	}
+}
+
+when %[1]q {
+	section "foo" {
+		likes_dogs = true
+	}
+}
+`, expr)
+
+	out := &myConf{}
+	err = hc.Decode(out, "foo.conf", []byte(data))
+	require.NoError(t, err)
+	require.True(t, out.Foo.LikesCats.Value())
+	require.True(t, out.Foo.LikesDogs.Value())
+
+	runs, err := ioutil.ReadFile(counter)
+	require.NoError(t, err)
+	require.Equal(t, "x\n", string(runs))
+}
+
+func TestWhenExecErrors(t *testing.T) {
+	hc, err := New(&Config{ExecAllowlist: []string{"echo", "sleep"}, ExecTimeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	out := &myConf{}
+	err = hc.Decode(out, "foo.conf", []byte(`
+when "local_Exec(\"hostname\") == \"web1\"" {
+	version = "2"
+}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:2")
+	require.Contains(t, err.Error(), "not allowed")
+
+	err = hc.Decode(out, "foo.conf", []byte(`when "local_Exec(\"sleep 5\") == \"\"" {}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "timed out")
+
+	err = hc.Decode(out, "foo.conf", []byte(`when "local_Exec(\"echo 'a b'\") == \"a b\"" { version = "3" }`))
+	require.NoError(t, err)
+	require.Equal(t, "3", out.Version)
+
+	_, err = New(&Config{ExecShell: true, ExecAllowlist: []string{"echo"}})
+	require.Error(t, err)
+
+	// children of the command that keep its output open are killed too
+	hc, err = New(&Config{ExecShell: true, ExecTimeout: 200 * time.Millisecond})
+	require.NoError(t, err)
+	start := time.Now()
+	err = hc.Decode(out, "foo.conf", []byte(`when "local_Exec(\"sleep 3; echo x\") == \"x\"" {}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "timed out")
+	require.True(t, time.Since(start) < 2*time.Second, "took %s", time.Since(start))
+}
+
+func TestDecodeFiles(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	system := filepath.Join(d, "system.conf")
+	user := filepath.Join(d, "user.conf")
+	err = ioutil.WriteFile(system, []byte(conf), 0600)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(user, []byte("section \"foo\" {\n\tscreensize = \"tiny\"\n}\n"), 0600)
+	require.NoError(t, err)
+
+	c := &myConf{}
+	err = hc.DecodeFiles(c, system, user, filepath.Join(d, "missing.conf"))
+	require.NoError(t, err)
+	require.Equal(t, "tiny", c.Foo.Screensize.Value())
+	require.True(t, c.Foo.LikesCats.Value())
+
+	v, pos, err := hc.Get(c, "foo", "screensize")
+	require.NoError(t, err)
+	require.Equal(t, "tiny", v.(*String).Value())
+	require.Equal(t, user, pos.Filename)
+	require.Equal(t, 2, pos.Line)
+
+	_, pos, err = hc.Get(c, "foo", "likes_cats")
+	require.NoError(t, err)
+	require.Equal(t, system, pos.Filename)
+}
+
+func TestDecodeGlob(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	err = ioutil.WriteFile(filepath.Join(d, "20-local.conf"), []byte(`section "foo" { screensize = "local" }`), 0600)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(d, "10-base.conf"), []byte(conf), 0600)
+	require.NoError(t, err)
+
+	c := &myConf{}
+	err = hc.DecodeGlob(c, filepath.Join(d, "*.conf"))
+	require.NoError(t, err)
+	require.Equal(t, "local", c.Foo.Screensize.Value())
+	require.Len(t, c.Foo.Friends.Value(), 2)
+
+	err = ioutil.WriteFile(filepath.Join(d, "30-bad.conf"), []byte(`section "nope" {}`), 0600)
+	require.NoError(t, err)
+	err = hc.DecodeGlob(c, filepath.Join(d, "*.conf"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "30-bad.conf:1")
+}
+
+type envConf struct {
+	Foo struct {
+		Screensize String      `hconf:"screensize"`
+		LikesCats  Bool        `hconf:"likes_cats"`
+		Friends    StringSlice `hconf:"friends"`
+		Age        Int64       `hconf:"age"`
+	} `hsection:"foo"`
+}
+
+func TestDecodeEnv(t *testing.T) {
+	hc, err := New(&Config{EnvPrefix: "HCONFTEST"})
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	require.Equal(t, "HCONFTEST_FOO_SCREENSIZE", EnvName("HCONFTEST", "foo", "screensize"))
+	require.Equal(t, "MY_APP_FOO_LIKES_CATS", EnvName("my-app", "foo", "likes.cats"))
+
+	env := map[string]string{
+		"HCONFTEST_FOO_SCREENSIZE": "huge",
+		"HCONFTEST_FOO_LIKES_CATS": "true",
+		"HCONFTEST_FOO_FRIENDS":    `["carol"]`,
+		"HCONFTEST_FOO_AGE":        "42",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	c := &envConf{}
+	err = hc.Decode(c, "foo.conf", []byte(conf2))
+	require.NoError(t, err)
+	err = hc.DecodeEnv(c)
+	require.NoError(t, err)
+	require.Equal(t, "huge", c.Foo.Screensize.Value())
+	require.Equal(t, "env:HCONFTEST_FOO_SCREENSIZE", c.Foo.Screensize.Source().Filename)
+	require.True(t, c.Foo.LikesCats.Value())
+	require.Equal(t, []string{"carol"}, c.Foo.Friends.Value())
+	require.Equal(t, int64(42), c.Foo.Age.Value())
+
+	os.Setenv("HCONFTEST_FOO_AGE", "old")
+	err = hc.DecodeEnv(c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "HCONFTEST_FOO_AGE")
+}
+
+const confErrors = `
+section "foo" {
+	likes_cats = "maybe"
+	screensize = "big"
+	colour = "blue"
+}
+
+section "nope" {
+	x = 1
+}
+
+version = "3"
+`
+
+func TestAllErrors(t *testing.T) {
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	out := &myConf{}
+	err = hc.Decode(out, "foo.conf", []byte(confErrors))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:3")
+
+	hc, err = New(&Config{AllErrors: true})
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	out = &myConf{}
+	err = hc.Decode(out, "foo.conf", []byte(confErrors))
+	require.Error(t, err)
+
+	errs, ok := err.(Errors)
+	require.True(t, ok)
+	require.Len(t, errs, 3)
+	require.Equal(t, "foo.conf", errs[0].Pos.Filename)
+	require.Equal(t, 3, errs[0].Pos.Line)
+	require.Equal(t, 5, errs[1].Pos.Line)
+	require.Equal(t, 8, errs[2].Pos.Line)
+	require.Contains(t, errs[1].Error(), "unknown key: foo.colour")
+
+	require.Equal(t, "big", out.Foo.Screensize.Value())
+	require.Equal(t, "3", out.Version)
+}
+
+func TestUnknownKeys(t *testing.T) {
+	data := []byte(`
+version = "4"
+colour = "blue"
+
+section "foo" {
+	screensize = "big"
+	shape = "round"
+}
+
+section "baz" {
+	x = 1
+}
+
+server "eu1" {
+}
+
+listener "tcp" "443" {
+}
+`)
+
+	var warnings []string
+	hc, err := New(&Config{
+		UnknownKeys: UnknownKeysWarn,
+		Warn: func(pos token.Pos, key string) {
+			warnings = append(warnings, fmt.Sprintf("%s %s", pos, key))
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	out := &myConf{}
+	err = hc.Decode(out, "foo.conf", data)
+	require.NoError(t, err)
+	require.Equal(t, "4", out.Version)
+	require.Equal(t, "big", out.Foo.Screensize.Value())
+	require.Equal(t, []string{
+		"foo.conf:3:1 colour",
+		"foo.conf:7:2 foo.shape",
+		"foo.conf:10:9 baz",
+		"foo.conf:14:1 server.eu1",
+		"foo.conf:17:1 listener.tcp.443",
+	}, warnings)
+
+	hc, err = New(&Config{UnknownKeys: UnknownKeysIgnore})
+	require.NoError(t, err)
+	out = &myConf{}
+	err = hc.Decode(out, "foo.conf", data)
+	require.NoError(t, err)
+	require.Equal(t, "big", out.Foo.Screensize.Value())
+}
+
+func TestFloat64Duration(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	out := &myConf{}
+	err = hc.Decode(out, "foo.conf", []byte(`
+section "net" {
+	timeout = "1m30s"
+	backoff = 5
+	ratio = 0.25
+	scale = 3
+}
+`))
+	require.NoError(t, err)
+	require.Equal(t, 90*time.Second, out.Net.Timeout.Value())
+	require.Equal(t, 5*time.Second, out.Net.Backoff.Value())
+	require.Equal(t, 0.25, out.Net.Ratio.Value())
+	require.Equal(t, float64(3), out.Net.Scale.Value())
+
+	v, pos, err := hc.Get(out, "net", "timeout")
+	require.NoError(t, err)
+	require.Equal(t, 90*time.Second, v.(*Duration).Value())
+	require.Equal(t, 3, pos.Line)
+
+	err = hc.Set(out, "net", "timeout", "5m")
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Minute, out.Net.Timeout.Value())
+	err = hc.Set(out, "net", "backoff", 2*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Second, out.Net.Backoff.Value())
+	err = hc.Set(out, "net", "ratio", "0.5")
+	require.NoError(t, err)
+	require.Equal(t, 0.5, out.Net.Ratio.Value())
+	err = hc.Set(out, "net", "ratio", 0.75)
+	require.NoError(t, err)
+	require.Equal(t, 0.75, out.Net.Ratio.Value())
+	err = hc.Set(out, "net", "timeout", "soon")
+	require.Error(t, err)
+
+	bad := &myConf{}
+	err = hc.Decode(bad, "foo.conf", []byte(`section "net" { timeout = "soon" }`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:1")
+
+	tpath := filepath.Join(d, "t.conf")
+	err = hc.EditAndSave(tpath, "net", "timeout", 45*time.Second)
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "net", "ratio", 1.5)
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	c := &myConf{}
+	err = hc.Decode(c, "t.conf", data)
+	require.NoError(t, err)
+	require.Equal(t, 45*time.Second, c.Net.Timeout.Value())
+	require.Equal(t, 1.5, c.Net.Ratio.Value())
+}
+
+type defaultsConf struct {
+	Name    String `hconf:"name" hdefault:"anonymous"`
+	Section struct {
+		Timeout Duration    `hconf:"timeout" hdefault:"30s"`
+		Retries Int64       `hconf:"retries" hdefault:"3"`
+		Verbose Bool        `hconf:"verbose" hdefault:"true"`
+		Hosts   StringSlice `hconf:"hosts" hdefault:"[\"a\", \"b\"]"`
+		Plain   String      `hconf:"plain"`
+	} `hsection:"s"`
+}
+
+func TestDefaults(t *testing.T) {
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	out := &defaultsConf{}
+	err = hc.Decode(out, "foo.conf", []byte(`
+section "s" {
+	retries = 5
+}
+`))
+	require.NoError(t, err)
+
+	require.Equal(t, "anonymous", out.Name.Value())
+	require.False(t, out.Name.IsSet())
+	require.True(t, out.Name.IsDefault())
+	require.Equal(t, DefaultSource, out.Name.Source())
+
+	require.Equal(t, 30*time.Second, out.Section.Timeout.Value())
+	require.True(t, out.Section.Timeout.IsDefault())
+	require.True(t, out.Section.Verbose.Value())
+	require.Equal(t, []string{"a", "b"}, out.Section.Hosts.Value())
+
+	require.Equal(t, int64(5), out.Section.Retries.Value())
+	require.True(t, out.Section.Retries.IsSet())
+	require.False(t, out.Section.Retries.IsDefault())
+	require.Equal(t, 3, out.Section.Retries.Source().Line)
+
+	require.False(t, out.Section.Plain.IsSet())
+	require.False(t, out.Section.Plain.IsDefault())
+
+	err = hc.Set(out, "s", "timeout", "1m")
+	require.NoError(t, err)
+	require.True(t, out.Section.Timeout.IsSet())
+	require.False(t, out.Section.Timeout.IsDefault())
+
+	bad := &struct {
+		Section struct {
+			Retries Int64 `hconf:"retries" hdefault:"many"`
+		} `hsection:"s"`
+	}{}
+	err = hc.Decode(bad, "foo.conf", []byte(``))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "s.retries")
+}
+
+type validateConf struct {
+	Server struct {
+		Host    String      `hconf:"host" hrequired:"true"`
+		Port    Int64       `hconf:"port" hmin:"1" hmax:"65535"`
+		Mode    String      `hconf:"mode" henum:"dev, prod" hdefault:"dev"`
+		Name    String      `hconf:"name" hregex:"[a-z][a-z0-9-]*" hmax:"8"`
+		Timeout Duration    `hconf:"timeout" hmin:"1s"`
+		Ratio   Float64     `hconf:"ratio" hmax:"1"`
+		Tags    StringSlice `hconf:"tags" henum:"a,b"`
+	} `hsection:"server"`
+}
+
+func TestValidate(t *testing.T) {
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	out := &validateConf{}
+	err = hc.Decode(out, "foo.conf", []byte(`
+section "server" {
+	host = "example.com"
+	port = 8080
+	name = "web-1"
+	timeout = "5s"
+	ratio = 0.5
+	tags = ["a"]
+}
+`))
+	require.NoError(t, err)
+	require.Equal(t, "dev", out.Server.Mode.Value())
+
+	out = &validateConf{}
+	err = hc.Decode(out, "foo.conf", []byte(`
+section "server" {
+	port = 0
+}
+`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:2:1: missing required key: server.host")
+
+	hc, err = New(&Config{AllErrors: true})
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	out = &validateConf{}
+	err = hc.Decode(out, "foo.conf", []byte(`
+section "server" {
+	port = 70000
+	mode = "test"
+	name = "Web_1"
+	timeout = "10ms"
+	ratio = 1.5
+	tags = ["a", "c"]
+}
+`))
+	require.Error(t, err)
+	errs, ok := err.(Errors)
+	require.True(t, ok)
+	require.Len(t, errs, 7)
+	require.Contains(t, errs[0].Error(), "missing required key: server.host")
+	require.Contains(t, errs[1].Error(), "foo.conf:3:9: server.port: value must be at most 65535")
+	require.Contains(t, errs[2].Error(), "server.mode: 'test' must be one of: dev, prod")
+	require.Contains(t, errs[3].Error(), "server.name: 'Web_1' must match")
+	require.Contains(t, errs[4].Error(), "server.timeout: duration must be at least 1s")
+	require.Contains(t, errs[5].Error(), "server.ratio: value must be at most 1")
+	require.Contains(t, errs[6].Error(), "server.tags: 'c' must be one of: a, b")
+
+	missing := &validateConf{}
+	err = hc.Decode(missing, "foo.conf", []byte(``))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "At foo.conf: missing required key: server.host")
+
+	err = hc.Set(missing, "server", "host", "example.com")
+	require.NoError(t, err)
+	require.NoError(t, hc.Validate(missing))
+
+	// nothing was read, so there is no position to report
+	err = hc.Validate(&validateConf{})
+	require.Error(t, err)
+	require.Equal(t, "1 errors:\n\tmissing required key: server.host", err.Error())
+
+	// a default satisfies hrequired
+	defaulted := &struct {
+		Server struct {
+			Host String `hconf:"host" hrequired:"true" hdefault:"localhost"`
+		} `hsection:"server"`
+	}{}
+	err = hc.Decode(defaulted, "foo.conf", []byte(``))
+	require.NoError(t, err)
+	require.Equal(t, "localhost", defaulted.Server.Host.Value())
+}
+
+func TestEncode(t *testing.T) {
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	c := &myConf{}
+	err = hc.Decode(c, "foo.conf", []byte(conf))
+	require.NoError(t, err)
+	c.Version = "2"
+	err = hc.Set(c, "net", "timeout", "30s")
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	err = hc.Encode(buf, c)
+	require.NoError(t, err)
+	require.Equal(t, `version = "2"
+
+section "foo" {
+  screensize = "hello world"
+  likes_cats = true
+  likes_dogs = false
+  friends    = ["alice", "bob"]
+}
+
+section "net" {
+  timeout = "30s"
+}`, buf.String())
+
+	c2 := &myConf{}
+	err = hc.Decode(c2, "foo.conf", buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, c.Foo.Screensize.Value(), c2.Foo.Screensize.Value())
+	require.Equal(t, c.Foo.Friends.Value(), c2.Foo.Friends.Value())
+	require.Equal(t, 30*time.Second, c2.Net.Timeout.Value())
+	require.False(t, c2.Bar.LikesCats.IsSet())
+
+	hc, err = New(&Config{EncodeAll: true})
+	require.NoError(t, err)
+	buf.Reset()
+	err = hc.Encode(buf, &defaultsConf{})
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `plain   = ""`)
+}
+
+const confCommented = `# global settings
+version = "1"
+
+section "foo" {
+    # how big the screen is
+    screensize   = "hello world" // pixels
+	likes_cats = true
+}
+
+/* the bar section */
+section "bar" { likes_dogs = false }
+`
+
+func TestEditPreservesLayout(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	tpath := filepath.Join(d, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte(confCommented), 0600)
+	require.NoError(t, err)
+
+	err = hc.EditAndSave(tpath, "foo", "screensize", "giant")
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "foo", "friends", []string{"alice"})
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "bar", "likes_cats", true)
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "net", "timeout", "30s")
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, `# global settings
+version = "1"
+
+section "foo" {
+    # how big the screen is
+    screensize   = "giant" // pixels
+	likes_cats = true
+    friends = ["alice"]
+}
+
+/* the bar section */
+section "bar" { likes_dogs = false likes_cats = true }
+
+section "net" {
+  timeout = "30s"
+}
+`, string(data))
+
+	c := &myConf{}
+	err = hc.Decode(c, "t.conf", data)
+	require.NoError(t, err)
+	require.Equal(t, "giant", c.Foo.Screensize.Value())
+	require.Equal(t, []string{"alice"}, c.Foo.Friends.Value())
+	require.True(t, c.Bar.LikesCats.Value())
+	require.Equal(t, 30*time.Second, c.Net.Timeout.Value())
+}
+
+func TestEditCRLF(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	crlf := func(s string) string {
+		return strings.Replace(s, "\n", "\r\n", -1)
+	}
+
+	tpath := filepath.Join(d, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte(crlf(conf)), 0600)
+	require.NoError(t, err)
+
+	err = hc.EditAndSave(tpath, "foo", "screensize", "bbbbb")
+	require.NoError(t, err)
+	err = hc.DeleteAndSave(tpath, "foo", "likes_dogs")
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "foo", "colour", "red")
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, crlf(`
+section "foo" {
+    screensize = "bbbbb"
+	likes_cats = true
+	friends = ["alice", "bob"]
+    colour = "red"
+}
+`), string(data))
+
+	dr, err := hc.EditDryRun(tpath, "foo", "colour", "blue")
+	require.NoError(t, err)
+	require.Contains(t, dr.Diff, "-    colour = \"red\"\r\n+    colour = \"blue\"\r\n")
+}
+
+func TestEditAtomicSave(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	tpath := filepath.Join(d, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte(conf), 0640)
+	require.NoError(t, err)
+	err = os.Chmod(tpath, 0640)
+	require.NoError(t, err)
+
+	err = hc.EditAndSave(tpath, "foo", "screensize", "giant")
+	require.NoError(t, err)
+
+	fi, err := os.Stat(tpath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+
+	entries, err := ioutil.ReadDir(d)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NotContains(t, entry.Name(), ".tmp")
+	}
+
+	npath := filepath.Join(d, "sub", "dir", "n.conf")
+	err = hc.EditAndSave(npath, "foo", "screensize", "giant")
+	require.NoError(t, err)
+	fi, err = os.Stat(npath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	blocker := filepath.Join(d, "blocker")
+	err = ioutil.WriteFile(blocker, nil, 0600)
+	require.NoError(t, err)
+	err = hc.EditAndSave(filepath.Join(blocker, "x.conf"), "foo", "screensize", "giant")
+	require.Error(t, err)
+}
+
+func TestDelete(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	tpath := filepath.Join(d, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte(confCommented+`
+section "net" {
+	timeout = "5s"
+}
+`), 0600)
+	require.NoError(t, err)
+
+	err = hc.DeleteAndSave(tpath, "foo", "screensize")
+	require.NoError(t, err)
+	err = hc.DeleteAndSave(tpath, "foo", "no_such_key")
+	require.NoError(t, err)
+	err = hc.DeleteAndSave(tpath, "bar", "likes_dogs")
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, `# global settings
+version = "1"
+
+section "foo" {
+	likes_cats = true
+}
+
+section "net" {
+	timeout = "5s"
+}
+`, string(data))
+
+	err = hc.DeleteSectionAndSave(tpath, "net")
+	require.NoError(t, err)
+	err = hc.DeleteAndSave(tpath, "foo", "likes_cats")
+	require.NoError(t, err)
+
+	data, err = ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, `# global settings
+version = "1"
+`, string(data))
+
+	err = hc.DeleteAndSave(filepath.Join(d, "missing.conf"), "foo", "screensize")
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(tpath, []byte(`section "foo" { screensize = "x" likes_cats = true }`), 0600)
+	require.NoError(t, err)
+	err = hc.DeleteAndSave(tpath, "foo", "screensize")
+	require.NoError(t, err)
+	data, err = ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, `section "foo" { likes_cats = true }`, string(data))
+}
+
+func TestEditor(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	tpath := filepath.Join(d, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte(conf), 0600)
+	require.NoError(t, err)
+
+	e, err := hc.OpenForEdit(tpath)
+	require.NoError(t, err)
+	require.NoError(t, e.Set("foo", "screensize", "giant"))
+	require.NoError(t, e.Delete("foo", "likes_dogs"))
+	require.NoError(t, e.Set("bar", "likes_cats", true))
+	require.NoError(t, e.SetTopLevel("version", "5"))
+	require.Error(t, e.Set("foo", "screensize", struct{}{}))
+
+	data, err := ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, conf, string(data))
+
+	require.NoError(t, e.Commit())
+	require.Equal(t, ErrEditorClosed, e.Set("foo", "screensize", "small"))
+
+	data, err = ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, `
+version = "5"
+
+section "foo" {
+    screensize = "giant"
+	likes_cats = true
+	friends = ["alice", "bob"]
+}
+
+section "bar" {
+  likes_cats = true
+}
+`, string(data))
+
+	e, err = hc.OpenForEdit(tpath)
+	require.NoError(t, err)
+	require.NoError(t, e.SetTopLevel("version", "6"))
+	require.NoError(t, e.Discard())
+	require.Equal(t, ErrEditorClosed, e.Commit())
+
+	c := &myConf{}
+	err = hc.DecodeFile(c, tpath)
+	require.NoError(t, err)
+	require.Equal(t, "5", c.Version)
+	require.Equal(t, "giant", c.Foo.Screensize.Value())
+	require.False(t, c.Foo.LikesDogs.IsSet())
+	require.True(t, c.Bar.LikesCats.Value())
+}
+
+func TestEditLocking(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	tpath := filepath.Join(d, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte(conf), 0600)
+	require.NoError(t, err)
+
+	hc, err := New(&Config{LockTimeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	e, err := hc.OpenForEdit(tpath)
+	require.NoError(t, err)
+
+	err = hc.EditAndSave(tpath, "foo", "screensize", "small")
+	require.Equal(t, ErrLockTimeout, err)
+
+	// a link to the file shares its lock
+	link := filepath.Join(d, "link.conf")
+	err = os.Symlink(tpath, link)
+	require.NoError(t, err)
+	err = hc.EditAndSave(link, "foo", "screensize", "small")
+	require.Equal(t, ErrLockTimeout, err)
+
+	// deleting from a missing file creates neither its directory nor a lock
+	missing := filepath.Join(d, "sub", "t.conf")
+	err = hc.DeleteAndSave(missing, "foo", "screensize")
+	require.NoError(t, err)
+	err = hc.DeleteSectionAndSave(missing, "foo")
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Dir(missing))
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, e.Set("foo", "screensize", "giant"))
+	require.NoError(t, e.Commit())
+
+	err = hc.EditAndSave(tpath, "foo", "likes_dogs", true)
+	require.NoError(t, err)
+
+	c := &myConf{}
+	err = hc.DecodeFile(c, tpath)
+	require.NoError(t, err)
+	require.Equal(t, "giant", c.Foo.Screensize.Value())
+	require.True(t, c.Foo.LikesDogs.Value())
+}
+
+func TestEditOptimistic(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	tpath := filepath.Join(d, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte(conf), 0600)
+	require.NoError(t, err)
+
+	hc, err := New(&Config{OptimisticEdits: true})
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	e1, err := hc.OpenForEdit(tpath)
+	require.NoError(t, err)
+	e2, err := hc.OpenForEdit(tpath)
+	require.NoError(t, err)
+
+	require.NoError(t, e1.Set("foo", "screensize", "one"))
+	require.NoError(t, e2.Set("foo", "screensize", "two"))
+	require.NoError(t, e1.Commit())
+	require.Equal(t, ErrConflict, e2.Commit())
+
+	c := &myConf{}
+	err = hc.DecodeFile(c, tpath)
+	require.NoError(t, err)
+	require.Equal(t, "one", c.Foo.Screensize.Value())
+}
+
+func TestTopLevelKeys(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	tpath := filepath.Join(d, "t.conf")
+	err = hc.EditAndSave(tpath, "", "version", "1")
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "foo", "screensize", "giant")
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "", "version", "2")
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, `version = "2"
+
+section "foo" {
+  screensize = "giant"
+}
+`, string(data))
+
+	c := &myConf{}
+	err = hc.Decode(c, "t.conf", data)
+	require.NoError(t, err)
+	require.Equal(t, "2", c.Version)
+
+	err = hc.Set(c, "", "version", "3")
+	require.NoError(t, err)
+	require.Equal(t, "3", c.Version)
+	err = hc.Set(c, "", "nope", "3")
+	require.Error(t, err)
+	err = hc.Set(c, "", "version", 3)
+	require.Error(t, err)
+
+	v, _, err := hc.Get(c, "", "version")
+	require.NoError(t, err)
+	require.Equal(t, "3", *v.(*string))
+
+	err = hc.DeleteAndSave(tpath, "", "version")
+	require.NoError(t, err)
+	data, err = ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, `section "foo" {
+  screensize = "giant"
+}
+`, string(data))
+
+	d2 := &defaultsConf{}
+	err = hc.Set(d2, "", "name", "bob")
+	require.NoError(t, err)
+	v, _, err = hc.Get(d2, "", "name")
+	require.NoError(t, err)
+	require.Equal(t, "bob", v.(*String).Value())
+}
+
+func TestEditAndSaveFor(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	tpath := filepath.Join(d, "t.conf")
+	orig := "section \"server\" {\n  host = \"example.com\"\n}\n"
+	err = ioutil.WriteFile(tpath, []byte(orig), 0600)
+	require.NoError(t, err)
+
+	err = hc.EditAndSaveFor(&validateConf{}, tpath, "srever", "port", "80")
+	require.Error(t, err)
+	err = hc.EditAndSaveFor(&validateConf{}, tpath, "server", "prot", "80")
+	require.Error(t, err)
+	err = hc.EditAndSaveFor(&validateConf{}, tpath, "server", "port", "eighty")
+	require.Error(t, err)
+	err = hc.EditAndSaveFor(validateConf{}, tpath, "server", "port", "80")
+	require.Error(t, err)
+
+	data, err := ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, orig, string(data))
+
+	err = hc.EditAndSaveFor(&validateConf{}, tpath, "server", "port", "80")
+	require.NoError(t, err)
+
+	c := &validateConf{}
+	err = hc.DecodeFile(c, tpath)
+	require.NoError(t, err)
+	require.Equal(t, int64(80), c.Server.Port.Value())
+
+	// values are written as Set converted them
+	fpath := filepath.Join(d, "foo.conf")
+	err = hc.EditAndSaveFor(&myConf{}, fpath, "foo", "likes_cats", "true")
+	require.NoError(t, err)
+	err = hc.EditAndSaveFor(&myConf{}, fpath, "foo", "friends", `["alice", "bob"]`)
+	require.NoError(t, err)
+	err = hc.EditAndSaveFor(&validateConf{}, tpath, "server", "port", 8080)
+	require.NoError(t, err)
+	err = hc.EditAndSaveFor(&validateConf{}, tpath, "server", "ratio", "0.5")
+	require.NoError(t, err)
+
+	data, err = ioutil.ReadFile(fpath)
+	require.NoError(t, err)
+	require.Equal(t, "section \"foo\" {\n  likes_cats = true\n  friends = [\"alice\", \"bob\"]\n}\n", string(data))
+	data, err = ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "port = 8080\n")
+	require.Contains(t, string(data), "ratio = 0.5\n")
+
+	// the check is a type check only: required keys may be missing, and
+	// commands in when conditions are not run
+	counter := filepath.Join(d, "counter")
+	npath := filepath.Join(d, "new.conf")
+	err = ioutil.WriteFile(npath, []byte(fmt.Sprintf("when \"local_Exec(\\\"touch %s\\\") == \\\"\\\"\" {\n  section \"server\" {\n    port = \"eighty\"\n  }\n}\n", counter)), 0600)
+	require.NoError(t, err)
+	err = hc.EditAndSaveFor(&validateConf{}, npath, "server", "port", "80")
+	require.Error(t, err)
+
+	err = os.Remove(npath)
+	require.NoError(t, err)
+	err = hc.EditAndSaveFor(&validateConf{}, npath, "server", "port", "80")
+	require.NoError(t, err)
+	_, err = os.Stat(counter)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestEditDryRun(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	tpath := filepath.Join(d, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte(conf), 0600)
+	require.NoError(t, err)
+
+	dr, err := hc.EditDryRun(tpath, "foo", "screensize", "giant")
+	require.NoError(t, err)
+	require.Equal(t, `--- `+tpath+`
++++ `+tpath+`
+@@ -1,6 +1,6 @@
+ 
+ section "foo" {
+-    screensize = "hello world"
++    screensize = "giant"
+ 	likes_cats = true
+ 	likes_dogs = false
+ 	friends = ["alice", "bob"]
+`, dr.Diff)
+	require.Contains(t, string(dr.Content), `screensize = "giant"`)
+
+	data, err := ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, conf, string(data))
+
+	e, err := hc.OpenForEdit(tpath)
+	require.NoError(t, err)
+	dr, err = e.DryRun()
+	require.NoError(t, err)
+	require.Equal(t, "", dr.Diff)
+	require.Equal(t, conf, string(dr.Content))
+
+	err = e.Set("foo", "screensize", "giant")
+	require.NoError(t, err)
+	err = e.Delete("foo", "likes_dogs")
+	require.NoError(t, err)
+	dr, err = e.DryRun()
+	require.NoError(t, err)
+	require.Contains(t, dr.Diff, "-\tlikes_dogs = false\n")
+	err = e.Commit()
+	require.NoError(t, err)
+
+	data, err = ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, string(dr.Content), string(data))
+
+	_, err = e.DryRun()
+	require.Equal(t, ErrEditorClosed, err)
+
+	dr, err = hc.EditDryRun(filepath.Join(d, "new.conf"), "", "version", "1")
+	require.NoError(t, err)
+	require.Equal(t, "--- "+filepath.Join(d, "new.conf")+"\n+++ "+filepath.Join(d, "new.conf")+"\n@@ -0,0 +1 @@\n+version = \"1\"\n", dr.Diff)
+
+	// a dry run creates neither the file's directory nor a lock file
+	before, err := ioutil.ReadDir(d)
+	require.NoError(t, err)
+	_, err = hc.EditDryRun(tpath, "foo", "screensize", "tiny")
+	require.NoError(t, err)
+	_, err = hc.EditDryRun(filepath.Join(d, "sub", "new.conf"), "foo", "screensize", "tiny")
+	require.NoError(t, err)
+	after, err := ioutil.ReadDir(d)
+	require.NoError(t, err)
+	require.Equal(t, before, after)
+}
+
+type blockConf struct {
+	DB struct {
+		Host String `hconf:"host"`
+		Pool struct {
+			Max  Int64    `hconf:"max" hmax:"100"`
+			Idle Duration `hconf:"idle" hdefault:"30s"`
+			TLS  struct {
+				Enabled Bool `hconf:"enabled"`
+			} `hblock:"tls"`
+		} `hblock:"pool"`
+		Port Int64 `hconf:"port"`
+	} `hsection:"db"`
+}
+
+const confBlocks = `
+section "db" {
+	host = "db.example.com"
+	pool {
+		max = 10
+		tls {
+			enabled = true
+		}
+	}
+}
+`
+
+func TestBlocks(t *testing.T) {
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	c := &blockConf{}
+	err = hc.Decode(c, "foo.conf", []byte(confBlocks))
+	require.NoError(t, err)
+	require.Equal(t, "db.example.com", c.DB.Host.Value())
+	require.Equal(t, int64(10), c.DB.Pool.Max.Value())
+	require.Equal(t, 30*time.Second, c.DB.Pool.Idle.Value())
+	require.True(t, c.DB.Pool.TLS.Enabled.Value())
+	require.Equal(t, 7, c.DB.Pool.TLS.Enabled.Source().Line)
+
+	err = hc.Decode(&blockConf{}, "foo.conf", []byte("section \"db\" {\n\tpool {\n\t\tmax = 1\n\t\tmin = 1\n\t}\n}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:4:3: unknown key: db.pool.min")
+
+	err = hc.Decode(&blockConf{}, "foo.conf", []byte("section \"db\" {\n\tpool {\n\t\tmax = 200\n\t}\n}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:3:9: db.pool.max: value must be at most 100")
+
+	err = hc.Decode(&blockConf{}, "foo.conf", []byte("section \"db\" {\n\tpool = 3\n}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expected block body for db.pool")
+
+	err = hc.Set(c, "db", "pool.max", "20")
+	require.NoError(t, err)
+	require.Equal(t, int64(20), c.DB.Pool.Max.Value())
+	err = hc.Set(c, "db", "pool.tls.enabled", false)
+	require.NoError(t, err)
+	require.False(t, c.DB.Pool.TLS.Enabled.Value())
+	err = hc.Set(c, "db", "pool.nope", "1")
+	require.Error(t, err)
+	err = hc.Set(c, "db", "nope.max", "1")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown block: nope in section db")
+
+	v, pos, err := hc.Get(c, "db", "pool.idle")
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, v.(*Duration).Value())
+	require.Equal(t, DefaultSource, pos)
+
+	var buf bytes.Buffer
+	err = hc.Encode(&buf, c)
+	require.NoError(t, err)
+	require.Equal(t, `section "db" {
+  host = "db.example.com"
+
+  pool {
+    max = 20
+
+    tls {
+      enabled = false
+    }
+  }
+}`, buf.String())
+
+	os.Setenv("HCONFTEST_DB_POOL_MAX", "7")
+	defer os.Unsetenv("HCONFTEST_DB_POOL_MAX")
+	envHC, err := New(&Config{EnvPrefix: "HCONFTEST"})
+	require.NoError(t, err)
+	err = envHC.DecodeEnv(c)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), c.DB.Pool.Max.Value())
+}
+
+func TestEditBlocks(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	tpath := filepath.Join(d, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte(confBlocks), 0600)
+	require.NoError(t, err)
+
+	e, err := hc.OpenForEdit(tpath)
+	require.NoError(t, err)
+	require.NoError(t, e.Set("db", "pool.max", 20))
+	require.NoError(t, e.Set("db", "pool.idle", "1m"))
+	require.NoError(t, e.Delete("db", "pool.tls.enabled"))
+	require.NoError(t, e.Commit())
+
+	data, err := ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, `
+section "db" {
+	host = "db.example.com"
+	pool {
+		max = 20
+		idle = "1m"
+	}
+}
+`, string(data))
+
+	e, err = hc.OpenForEdit(tpath)
+	require.NoError(t, err)
+	require.NoError(t, e.Delete("db", "pool.max"))
+	require.NoError(t, e.Set("db", "pool.tls.enabled", true))
+	require.NoError(t, e.Set("db", "cache.size", 5))
+	require.NoError(t, e.Commit())
+
+	data, err = ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, `
+section "db" {
+	host = "db.example.com"
+	pool {
+		idle = "1m"
+		tls.enabled = true
+	}
+	cache.size = 5
+}
+`, string(data))
+	require.NoError(t, hc.DeleteAndSave(tpath, "db", "cache.size"))
+
+	c := &blockConf{}
+	err = hc.DecodeFile(c, tpath)
+	require.NoError(t, err)
+	require.True(t, c.DB.Pool.TLS.Enabled.Value())
+
+	err = hc.EditAndSaveFor(&blockConf{}, tpath, "db", "pool.tls.enabeld", false)
+	require.Error(t, err)
+
+	e, err = hc.OpenForEdit(tpath)
+	require.NoError(t, err)
+	defer e.Discard()
+
+	// a block is not a value, so setting or deleting its name leaves it alone
+	require.NoError(t, e.Delete("db", "pool"))
+	require.NoError(t, e.Set("db", "pool", "x"))
+	dr, err := e.DryRun()
+	require.NoError(t, err)
+	require.Contains(t, string(dr.Content), "\t\tidle = \"1m\"\n")
+	require.Contains(t, string(dr.Content), "\tpool = \"x\"\n")
+
+	err = e.Set("db", "a b", "x")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unparseable")
+}
+
+func TestDottedKeys(t *testing.T) {
+	d, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(d)
+
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	type dottedConf struct {
+		A struct {
+			AB String `hconf:"a.b"`
+			C  struct {
+				D String `hconf:"d"`
+			} `hblock:"c"`
+		} `hsection:"a"`
+	}
+
+	c := &dottedConf{}
+	err = hc.Set(c, "a", "a.b", "x")
+	require.NoError(t, err)
+	require.Equal(t, "x", c.A.AB.Value())
+	err = hc.Set(c, "a", "c.d", "y")
+	require.NoError(t, err)
+	require.Equal(t, "y", c.A.C.D.Value())
+
+	tpath := filepath.Join(d, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte("section \"a\" {\n  a.b = \"y\"\n  c.d = \"w\"\n}\n"), 0600)
+	require.NoError(t, err)
+
+	err = hc.EditAndSave(tpath, "a", "a.b", "z")
+	require.NoError(t, err)
+	data, err := ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, "section \"a\" {\n  a.b = \"z\"\n  c.d = \"w\"\n}\n", string(data))
+
+	c = &dottedConf{}
+	err = hc.DecodeFile(c, tpath)
+	require.NoError(t, err)
+	require.Equal(t, "z", c.A.AB.Value())
+	require.Equal(t, "w", c.A.C.D.Value())
+
+	var buf bytes.Buffer
+	err = hc.Encode(&buf, c)
+	require.NoError(t, err)
+	require.Equal(t, "section \"a\" {\n  a.b = \"z\"\n\n  c {\n    d = \"w\"\n  }\n}", buf.String())
+
+	c2 := &dottedConf{}
+	err = hc.Decode(c2, "foo.conf", buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, "z", c2.A.AB.Value())
+	require.Equal(t, "w", c2.A.C.D.Value())
+}
+
+type serverConf struct {
+	Block
+	Addr String `hconf:"addr" hrequired:"true"`
+	Port Int64  `hconf:"port" hdefault:"443"`
+	TLS  struct {
+		Enabled Bool `hconf:"enabled"`
+	} `hblock:"tls"`
+}
+
+type labeledConf struct {
+	Version string                `hconf:"version"`
+	Servers map[string]serverConf `hlabeled:"server"`
+	Mirrors []serverConf          `hlabeled:"mirror"`
+}
+
+const confLabeled = `version = "1"
+
+server "eu1" {
+	addr = "eu1.example.com"
+}
+
+server "us1" {
+	addr = "us1.example.com"
+	port = 8443
+	tls {
+		enabled = true
+	}
+}
+
+mirror "b" {
+	addr = "b.example.com"
+}
+
+mirror "a" {
+	addr = "a.example.com"
+}
+
+server "eu1" {
+	port = 8080
+}
+`
+
+func TestLabeledBlocks(t *testing.T) {
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	c := &labeledConf{}
+	err = hc.Decode(c, "foo.conf", []byte(confLabeled))
+	require.NoError(t, err)
+	require.Equal(t, "1", c.Version)
+	require.Len(t, c.Servers, 2)
+
+	eu1 := c.Servers["eu1"]
+	require.Equal(t, "eu1", eu1.Label())
+	require.Equal(t, 3, eu1.Source().Line)
+	require.Equal(t, "foo.conf", eu1.Source().Filename)
+	require.Equal(t, "eu1.example.com", eu1.Addr.Value())
+	require.Equal(t, int64(8080), eu1.Port.Value())
+	require.False(t, eu1.TLS.Enabled.IsSet())
+
+	us1 := c.Servers["us1"]
+	require.Equal(t, "us1", us1.Label())
+	require.Equal(t, int64(8443), us1.Port.Value())
+	require.True(t, us1.TLS.Enabled.Value())
+
+	require.Len(t, c.Mirrors, 2)
+	require.Equal(t, "b", c.Mirrors[0].Label())
+	require.Equal(t, "a", c.Mirrors[1].Label())
+	require.Equal(t, int64(443), c.Mirrors[1].Port.Value())
+	require.True(t, c.Mirrors[1].Port.IsDefault())
+
+	err = hc.Decode(&labeledConf{}, "foo.conf", []byte("server \"eu1\" {\n\tport = 1\n}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:1:1: missing required key: server.eu1.addr")
+
+	err = hc.Decode(&labeledConf{}, "foo.conf", []byte("server \"eu1\" {\n\taddr = \"x\"\n\tname = \"x\"\n}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:3:2: unknown key: server.eu1.name")
+
+	err = hc.Decode(&labeledConf{}, "foo.conf", []byte("client \"eu1\" {\n}\n"))
+	require.Error(t, err)
+
+	err = hc.Decode(&struct {
+		Servers map[string]string `hlabeled:"server"`
+	}{}, "foo.conf", []byte(confLabeled))
+	require.Error(t, err)
+
+	var buf bytes.Buffer
+	err = hc.Encode(&buf, c)
+	require.NoError(t, err)
+	require.Equal(t, `version = "1"
+
+server "eu1" {
+  addr = "eu1.example.com"
+  port = 8080
+}
+
+server "us1" {
+  addr = "us1.example.com"
+  port = 8443
+
+  tls {
+    enabled = true
+  }
+}
+
+mirror "b" {
+  addr = "b.example.com"
+}
+
+mirror "a" {
+  addr = "a.example.com"
+}`, buf.String())
+
+	c2 := &labeledConf{}
+	err = hc.Decode(c2, "bar.conf", buf.Bytes())
+	require.NoError(t, err)
+	eu1 = c2.Servers["eu1"]
+	require.Equal(t, int64(8080), eu1.Port.Value())
+}
+
+type mapConf struct {
+	Labels StringMap `hconf:"labels"`
+	App    struct {
+		Tags StringMap `hconf:"tags" hmax:"2"`
+	} `hsection:"app"`
+}
+
+const confMap = `labels = { team = "infra", tier = 1 }
+
+section "app" {
+	tags = {
+		"a.b" = "x"
+	}
+}
+`
+
+func TestStringMap(t *testing.T) {
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	c := &mapConf{}
+	err = hc.Decode(c, "foo.conf", []byte(confMap))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"team": "infra", "tier": "1"}, c.Labels.Value())
+	require.Equal(t, 1, c.Labels.Source().Line)
+	require.Equal(t, 28, c.Labels.EntrySource("tier").Column)
+	require.Equal(t, map[string]string{"a.b": "x"}, c.App.Tags.Value())
+	require.Equal(t, 5, c.App.Tags.EntrySource("a.b").Line)
+
+	err = hc.Decode(&mapConf{}, "foo.conf", []byte(`labels = ["a"]`))
+	require.Error(t, err)
+	err = hc.Decode(&mapConf{}, "foo.conf", []byte(`labels = { team = ["a"] }`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "labels.team")
+	err = hc.Decode(&mapConf{}, "foo.conf", []byte("section \"app\" {\n\ttags = { a = \"1\", b = \"2\", c = \"3\" }\n}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "app.tags: length must be at most 2")
+
+	err = hc.Set(c, "", "labels", `{"team": "web"}`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"team": "web"}, c.Labels.Value())
+	err = hc.Set(c, "", "labels", `["web"]`)
+	require.Error(t, err)
+	err = hc.Set(c, "app", "tags", map[string]string{"b": "y"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"b": "y"}, c.App.Tags.Value())
+
+	d := c.App.Tags.Duplicate()
+	d.Value()["b"] = "z"
+	require.Equal(t, "y", c.App.Tags.Value()["b"])
+
+	var buf bytes.Buffer
+	err = hc.Encode(&buf, c)
+	require.NoError(t, err)
+	require.Equal(t, `labels = {
+  team = "web"
+}
+
+section "app" {
+  tags = {
+    b = "y"
+  }
+}`, buf.String())
+
+	dir, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tpath := filepath.Join(dir, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte(confMap), 0600)
+	require.NoError(t, err)
+
+	err = hc.EditAndSave(tpath, "app", "tags", map[string]string{"x": "1", "a b": "2"})
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "", "labels", map[string]string{"team": "web"})
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(tpath)
+	require.NoError(t, err)
+	require.Equal(t, `labels = {
+  team = "web"
+}
+
+section "app" {
+	tags = {
+		"a b" = "2"
+		x     = "1"
+	}
+}
+`, string(data))
+
+	c = &mapConf{}
+	err = hc.DecodeFile(c, tpath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"x": "1", "a b": "2"}, c.App.Tags.Value())
+}
+
+type listConf struct {
+	Net struct {
+		Ports   Int64Slice   `hconf:"ports"`
+		Flags   BoolSlice    `hconf:"flags"`
+		Backoff Float64Slice `hconf:"backoff"`
+		Names   StringSlice  `hconf:"names"`
+	} `hsection:"net"`
+}
+
+const confLists = `
+section "net" {
+	ports = [80, 443]
+	flags = [true, false]
+	backoff = [0.5, 1, 2.5]
+}
+`
+
+func TestTypedSlices(t *testing.T) {
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	c := &listConf{}
+	err = hc.Decode(c, "foo.conf", []byte(confLists))
+	require.NoError(t, err)
+	require.Equal(t, []int64{80, 443}, c.Net.Ports.Value())
+	require.Equal(t, []bool{true, false}, c.Net.Flags.Value())
+	require.Equal(t, []float64{0.5, 1, 2.5}, c.Net.Backoff.Value())
+	require.True(t, c.Net.Ports.IsSet())
+	require.Equal(t, 3, c.Net.Ports.Source().Line)
+
+	err = hc.Decode(&listConf{}, "foo.conf", []byte("section \"net\" {\n\tports = [80,\n\t\t\"http\"]\n}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:3:3: net.ports[1]")
+
+	err = hc.Decode(&listConf{}, "foo.conf", []byte("section \"net\" {\n\tnames = [\"a\", 1]\n}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:2:16: net.names[1]")
+
+	err = hc.Decode(&listConf{}, "foo.conf", []byte("section \"net\" {\n\tflags = true\n}\n"))
+	require.Error(t, err)
+
+	err = hc.Set(c, "net", "ports", "[8080]")
+	require.NoError(t, err)
+	require.Equal(t, []int64{8080}, c.Net.Ports.Value())
+	err = hc.Set(c, "net", "ports", `["a"]`)
+	require.Error(t, err)
+	err = hc.Set(c, "net", "flags", []bool{false})
+	require.NoError(t, err)
+	require.Equal(t, []bool{false}, c.Net.Flags.Value())
+	err = hc.Set(c, "net", "backoff", "[1.5]")
+	require.NoError(t, err)
+	require.Equal(t, []float64{1.5}, c.Net.Backoff.Value())
+
+	d := c.Net.Ports.Duplicate()
+	d.Value()[0] = 1
+	require.Equal(t, int64(8080), c.Net.Ports.Value()[0])
+
+	var buf bytes.Buffer
+	err = hc.Encode(&buf, c)
+	require.NoError(t, err)
+	require.Equal(t, `section "net" {
+  ports   = [8080]
+  flags   = [false]
+  backoff = [1.5]
+}`, buf.String())
+
+	dir, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tpath := filepath.Join(dir, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte(confLists), 0600)
+	require.NoError(t, err)
+
+	err = hc.EditAndSave(tpath, "net", "ports", []int64{22, 80})
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "net", "flags", []bool{true})
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "net", "backoff", []float64{0.25, 3})
+	require.NoError(t, err)
+
+	c = &listConf{}
+	err = hc.DecodeFile(c, tpath)
+	require.NoError(t, err)
+	require.Equal(t, []int64{22, 80}, c.Net.Ports.Value())
+	require.Equal(t, []bool{true}, c.Net.Flags.Value())
+	require.Equal(t, []float64{0.25, 3}, c.Net.Backoff.Value())
+}
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return fmt.Errorf("unknown level %q", text)
+	}
+	return nil
+}
+
+func (l level) MarshalText() ([]byte, error) {
+	if l == 2 {
+		return []byte("high"), nil
+	}
+	return []byte("low"), nil
+}
+
+type plainConf struct {
+	Name  string `hconf:"name"`
+	Plain struct {
+		Count   int64             `hconf:"count"`
+		Small   int32             `hconf:"small"`
+		Size    uint              `hconf:"size"`
+		Ratio   float32           `hconf:"ratio"`
+		Enabled bool              `hconf:"enabled"`
+		Timeout time.Duration     `hconf:"timeout"`
+		Names   []string          `hconf:"names"`
+		Ports   []uint16          `hconf:"ports"`
+		Labels  map[string]string `hconf:"labels"`
+		Level   level             `hconf:"level"`
+		When    time.Time         `hconf:"when"`
+		Ptr     *int              `hconf:"ptr"`
+	} `hsection:"plain"`
+}
+
+const confPlain = `
+name = "app"
+
+section "plain" {
+	count = 9000000000
+	small = -3
+	size = 42
+	ratio = 0.5
+	enabled = true
+	timeout = "1m30s"
+	names = ["a", "b"]
+	ports = [80, 443]
+	labels = { team = "infra" }
+	level = "high"
+	when = "2020-01-02T03:04:05Z"
+	ptr = 7
+}
+`
+
+func TestPlainTypes(t *testing.T) {
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	c := &plainConf{}
+	err = hc.Decode(c, "foo.conf", []byte(confPlain))
+	require.NoError(t, err)
+	require.Equal(t, "app", c.Name)
+	require.Equal(t, int64(9000000000), c.Plain.Count)
+	require.Equal(t, int32(-3), c.Plain.Small)
+	require.Equal(t, uint(42), c.Plain.Size)
+	require.Equal(t, float32(0.5), c.Plain.Ratio)
+	require.True(t, c.Plain.Enabled)
+	require.Equal(t, 90*time.Second, c.Plain.Timeout)
+	require.Equal(t, []string{"a", "b"}, c.Plain.Names)
+	require.Equal(t, []uint16{80, 443}, c.Plain.Ports)
+	require.Equal(t, map[string]string{"team": "infra"}, c.Plain.Labels)
+	require.Equal(t, level(2), c.Plain.Level)
+	require.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), c.Plain.When)
+	require.Equal(t, 7, *c.Plain.Ptr)
+
+	for _, bad := range []string{
+		"small = 3000000000",
+		"size = -1",
+		"ports = [80, 70000]",
+		"level = \"medium\"",
+		"when = \"yesterday\"",
+		"names = \"a\"",
+	} {
+		err = hc.Decode(&plainConf{}, "foo.conf", []byte("section \"plain\" {\n\t"+bad+"\n}\n"))
+		require.Error(t, err, bad)
+		require.Contains(t, err.Error(), "foo.conf:2:", bad)
+	}
+
+	err = hc.Decode(&struct {
+		S struct {
+			Inner struct{ A int } `hconf:"inner"`
+		} `hsection:"s"`
+	}{}, "foo.conf", []byte("section \"s\" {\n\tinner = 1\n}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot decode into")
+
+	err = hc.Set(c, "plain", "size", "7")
+	require.NoError(t, err)
+	require.Equal(t, uint(7), c.Plain.Size)
+	err = hc.Set(c, "plain", "timeout", "5s")
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Second, c.Plain.Timeout)
+	err = hc.Set(c, "plain", "ports", "[22]")
+	require.NoError(t, err)
+	require.Equal(t, []uint16{22}, c.Plain.Ports)
+	err = hc.Set(c, "plain", "level", "low")
+	require.NoError(t, err)
+	require.Equal(t, level(1), c.Plain.Level)
+	err = hc.Set(c, "plain", "when", "2021-01-02T03:04:05Z")
+	require.NoError(t, err)
+	require.Equal(t, 2021, c.Plain.When.Year())
+	err = hc.Set(c, "plain", "size", -1)
+	require.Error(t, err)
+	err = hc.Set(c, "plain", "size", nil)
+	require.Error(t, err)
+
+	err = hc.Decode(&struct {
+		S struct {
+			Port int `hconf:"port" hmin:"1"`
+		} `hsection:"s"`
+	}{}, "foo.conf", []byte("section \"s\" {\n\tport = 0\n}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "s.port: hmin tag is not supported on int")
+
+	var buf bytes.Buffer
+	err = hc.Encode(&buf, c)
+	require.NoError(t, err)
+	c2 := &plainConf{}
+	err = hc.Decode(c2, "bar.conf", buf.Bytes())
+	require.NoError(t, err, buf.String())
+	require.Equal(t, c, c2)
+
+	dir, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tpath := filepath.Join(dir, "t.conf")
+	err = hc.EditAndSave(tpath, "plain", "level", level(2))
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "plain", "ports", []uint16{1, 2})
+	require.NoError(t, err)
+
+	c = &plainConf{}
+	err = hc.DecodeFile(c, tpath)
+	require.NoError(t, err)
+	require.Equal(t, level(2), c.Plain.Level)
+	require.Equal(t, []uint16{1, 2}, c.Plain.Ports)
+}
+
+type urlValue struct {
+	source token.Pos
+	value  *url.URL
+}
+
+func (u *urlValue) UnmarshalHCL(node ast.Node, pos token.Pos) error {
+	lit, ok := node.(*ast.LiteralType)
+	if !ok || lit.Token.Type != token.STRING {
+		return fmt.Errorf("expected a URL string")
+	}
+
+	v, err := url.Parse(lit.Token.Value().(string))
+	if err != nil {
+		return err
+	}
+	if v.Scheme == "" {
+		return fmt.Errorf("URL %q has no scheme", v)
+	}
+
+	u.value = v
+	u.source = pos
+	return nil
+}
+
+func (u *urlValue) MarshalHCL() (ast.Node, error) {
+	return &ast.LiteralType{
+		Token: token.Token{
+			Type: token.STRING,
+			Text: strconv.Quote(u.value.String()),
+		},
+	}, nil
+}
+
+func (u *urlValue) SetSource(p token.Pos) {
+	u.source = p
+}
+
+func (u *urlValue) Source() token.Pos {
+	return u.source
+}
+
+func (u *urlValue) IsSet() bool {
+	return u.value != nil
+}
+
+type customConf struct {
+	Net struct {
+		Proxy   urlValue  `hconf:"proxy"`
+		Mirror  urlValue  `hconf:"mirror"`
+		Allowed net.IPNet `hconf:"allowed"`
+	} `hsection:"net"`
+}
+
+func registerCIDR(c *Config) {
+	c.RegisterType(net.IPNet{}, func(out interface{}, node ast.Node, pos token.Pos) error {
+		lit, ok := node.(*ast.LiteralType)
+		if !ok || lit.Token.Type != token.STRING {
+			return fmt.Errorf("expected a CIDR string")
+		}
+
+		_, n, err := net.ParseCIDR(lit.Token.Value().(string))
+		if err != nil {
+			return err
+		}
+		*out.(*net.IPNet) = *n
+		return nil
+	}, func(in interface{}) (ast.Node, error) {
+		n := in.(net.IPNet)
+		return &ast.LiteralType{
+			Token: token.Token{
+				Type: token.STRING,
+				Text: strconv.Quote(n.String()),
+			},
+		}, nil
+	})
+}
+
+const confCustom = `
+section "net" {
+	proxy = "http://proxy.example.com:3128"
+	allowed = "10.0.0.0/8"
+}
+`
+
+func TestCustomTypes(t *testing.T) {
+	config := &Config{}
+	registerCIDR(config)
+	hc, err := New(config)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	c := &customConf{}
+	err = hc.Decode(c, "foo.conf", []byte(confCustom))
+	require.NoError(t, err)
+	require.Equal(t, "proxy.example.com:3128", c.Net.Proxy.value.Host)
+	require.Equal(t, 3, c.Net.Proxy.Source().Line)
+	require.False(t, c.Net.Mirror.IsSet())
+	require.Equal(t, "10.0.0.0/8", c.Net.Allowed.String())
+
+	err = hc.Decode(&customConf{}, "foo.conf", []byte("section \"net\" {\n\tproxy = \"proxy\"\n}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:2:10: net.proxy: URL \"proxy\" has no scheme")
+
+	err = hc.Decode(&customConf{}, "foo.conf", []byte("section \"net\" {\n\tallowed = \"10.0.0.0\"\n}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo.conf:2:12: net.allowed")
+
+	plain, err := New(nil)
+	require.NoError(t, err)
+	err = plain.Decode(&customConf{}, "foo.conf", []byte(confCustom))
+	require.Error(t, err)
+
+	err = hc.Set(c, "net", "mirror", "https://mirror.example.com")
+	require.NoError(t, err)
+	require.True(t, c.Net.Mirror.IsSet())
+	err = hc.Set(c, "net", "mirror", "mirror")
+	require.Error(t, err)
+	err = hc.Set(c, "net", "allowed", "192.168.0.0/16")
+	require.NoError(t, err)
+	require.Equal(t, "192.168.0.0/16", c.Net.Allowed.String())
+
+	v, pos, err := hc.Get(c, "net", "proxy")
+	require.NoError(t, err)
+	require.Equal(t, "http", v.(*urlValue).value.Scheme)
+	require.Equal(t, 3, pos.Line)
+
+	var buf bytes.Buffer
+	err = hc.Encode(&buf, c)
+	require.NoError(t, err)
+	require.Equal(t, `section "net" {
+  proxy   = "http://proxy.example.com:3128"
+  mirror  = "https://mirror.example.com"
+  allowed = "192.168.0.0/16"
+}`, buf.String())
+
+	dir, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tpath := filepath.Join(dir, "t.conf")
+	err = ioutil.WriteFile(tpath, []byte(confCustom), 0600)
+	require.NoError(t, err)
+
+	err = hc.EditAndSave(tpath, "net", "mirror", c.Net.Mirror)
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "net", "allowed", c.Net.Allowed)
+	require.NoError(t, err)
+
+	c = &customConf{}
+	err = hc.DecodeFile(c, tpath)
+	require.NoError(t, err)
+	require.Equal(t, "mirror.example.com", c.Net.Mirror.value.Host)
+	require.Equal(t, "192.168.0.0/16", c.Net.Allowed.String())
+
+	// types registered after New are not seen
+	config = &Config{}
+	late, err := New(config)
+	require.NoError(t, err)
+	registerCIDR(config)
+	err = late.Decode(&customConf{}, "foo.conf", []byte(confCustom))
+	require.Error(t, err)
+
+	// pointer types can be registered too
+	config = &Config{}
+	config.RegisterType(&url.URL{}, func(out interface{}, node ast.Node, pos token.Pos) error {
+		lit, ok := node.(*ast.LiteralType)
+		if !ok || lit.Token.Type != token.STRING {
+			return fmt.Errorf("expected a URL string")
+		}
+
+		u, err := url.Parse(lit.Token.Value().(string))
+		if err != nil {
+			return err
+		}
+		*out.(**url.URL) = u
+		return nil
+	}, func(in interface{}) (ast.Node, error) {
+		return &ast.LiteralType{
+			Token: token.Token{
+				Type: token.STRING,
+				Text: strconv.Quote(in.(*url.URL).String()),
+			},
+		}, nil
+	})
+	hc, err = New(config)
+	require.NoError(t, err)
+
+	upath := filepath.Join(dir, "u.conf")
+	home, err := url.Parse("https://example.com/x")
+	require.NoError(t, err)
+	err = hc.EditAndSave(upath, "", "home", home)
+	require.NoError(t, err)
+
+	uc := &struct {
+		Home *url.URL `hconf:"home"`
+	}{}
+	err = hc.DecodeFile(uc, upath)
+	require.NoError(t, err)
+	require.Equal(t, home, uc.Home)
+}
+
+type durationsConf struct {
+	P struct {
+		Ds  []time.Duration          `hconf:"ds"`
+		Pd  *time.Duration           `hconf:"pd"`
+		Md  map[string]time.Duration `hconf:"md"`
+		One time.Duration            `hconf:"one"`
+	} `hsection:"p"`
+}
+
+func TestPlainDurations(t *testing.T) {
+	hc, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, hc)
+
+	pd := 90 * time.Second
+	c := &durationsConf{}
+	c.P.Ds = []time.Duration{5 * time.Second, time.Minute}
+	c.P.Pd = &pd
+	c.P.Md = map[string]time.Duration{"a": 2 * time.Hour}
+	c.P.One = time.Millisecond
+
+	var buf bytes.Buffer
+	err = hc.Encode(&buf, c)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `ds = ["5s", "1m0s"]`)
+	require.Contains(t, buf.String(), `pd = "1m30s"`)
+
+	c2 := &durationsConf{}
+	err = hc.Decode(c2, "foo.conf", buf.Bytes())
+	require.NoError(t, err, buf.String())
+	require.Equal(t, c, c2)
+
+	dir, err := ioutil.TempDir("", "hconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tpath := filepath.Join(dir, "t.conf")
+	err = hc.EditAndSave(tpath, "p", "ds", c.P.Ds)
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "p", "pd", c.P.Pd)
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "p", "md", c.P.Md)
+	require.NoError(t, err)
+	err = hc.EditAndSave(tpath, "p", "one", c.P.One)
+	require.NoError(t, err)
+
+	c2 = &durationsConf{}
+	err = hc.DecodeFile(c2, tpath)
+	require.NoError(t, err)
+	require.Equal(t, c, c2)
+	err = hc.Set(c, "p", "ds", `["3s", "1h"]`)
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{3 * time.Second, time.Hour}, c.P.Ds)
+	err = hc.Set(c, "p", "md", `{"b": "10ms"}`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{"b": 10 * time.Millisecond}, c.P.Md)
+	err = hc.Set(c, "p", "ds", `["soon"]`)
+	require.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package hconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLockTimeout is returned when the lock for a file could not be taken
+// within Config.LockTimeout.
+var ErrLockTimeout = errors.New("hconf: timed out waiting for file lock")
+
+// lockPollInterval is how often a contended lock is retried when waiting
+// with a timeout.
+const lockPollInterval = 10 * time.Millisecond
+
+// lockPath returns the sidecar file locked while filename is edited. The
+// sidecar is left in place, as removing it would let two processes hold
+// locks on different files. A symlink is resolved first, so every link to
+// a file shares its lock, as they share the file the save replaces.
+func lockPath(filename string) string {
+	if resolved, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = resolved
+	}
+	return filename + ".lock"
+}
+
+// lockFile takes an exclusive advisory lock for filename, waiting up to
+// timeout, or indefinitely if timeout is zero.
+func lockFile(filename string, timeout time.Duration) (*fileLock, error) {
+	path := lockPath(filename)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout == 0 {
+		err = lockWait(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &fileLock{f: f}, nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := lockTry(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			return &fileLock{f: f}, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, ErrLockTimeout
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+type fileLock struct {
+	f *os.File
+}
+
+func (l *fileLock) unlock() error {
+	err := unlock(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
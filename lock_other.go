@@ -0,0 +1,23 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package hconf
+
+import (
+	"os"
+)
+
+// Advisory locks are not implemented on this platform, so locking always
+// succeeds immediately.
+
+func lockWait(f *os.File) error {
+	return nil
+}
+
+func lockTry(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlock(f *os.File) error {
+	return nil
+}
@@ -23,9 +23,16 @@ func parseExpression(in string) (hcpredicate, error) {
 			LE:  le,
 			GT:  gt,
 			GE:  ge,
+			NOT: not,
 		},
 		Functions: map[string]interface{}{
 			"local_Exec": localExec,
+			"os":         factOS,
+			"arch":       factArch,
+			"hostname":   factHostname,
+			"env":        factEnv,
+			"uid":        factUID,
+			"user":       factUser,
 		},
 	})
 	if err != nil {
@@ -217,8 +224,70 @@ func float64GT(m toFloat64, val interface{}) (hcpredicate, error) {
 	}, nil
 }
 
-func localExec(x string) toString {
+// evalError carries a failure out of a mapper, which has no error return,
+// back to evaluate.
+type evalError struct {
+	err error
+}
+
+// evaluate runs the predicate against hc, returning any error raised by the
+// mappers it calls.
+func (hc *HC) evaluate(p hcpredicate) (result bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ee, ok := r.(evalError)
+			if !ok {
+				panic(r)
+			}
+			err = ee.err
+		}
+	}()
+	return p(hc), nil
+}
+
+// localExec returns the trimmed output of running command on the local host.
+func localExec(command string) toString {
+	return func(c *HC) string {
+		out, err := c.localExec(command)
+		if err != nil {
+			panic(evalError{err: err})
+		}
+		return out
+	}
+}
+
+func factOS() toString {
+	return func(c *HC) string {
+		return c.facts().OS()
+	}
+}
+
+func factArch() toString {
+	return func(c *HC) string {
+		return c.facts().Arch()
+	}
+}
+
+func factHostname() toString {
+	return func(c *HC) string {
+		return c.facts().Hostname()
+	}
+}
+
+func factEnv(name string) toString {
+	return func(c *HC) string {
+		return c.facts().Env(name)
+	}
+}
+
+func factUID() toInt {
+	return func(c *HC) int {
+		return c.facts().UID()
+	}
+}
+
+func factUser() toString {
 	return func(c *HC) string {
-		return x
+		return c.facts().User()
 	}
 }
@@ -0,0 +1,68 @@
+package hconf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic replaces filename with data. The data is written to a
+// temporary file in the same directory, synced and renamed over filename, so
+// a crash leaves either the old or the new content. An existing file keeps
+// its mode, and its owner when running as root; new files are created 0600.
+func writeFileAtomic(filename string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = resolved
+	}
+
+	dirname := filepath.Dir(filename)
+	err := os.MkdirAll(dirname, 0755)
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0600)
+	fi, err := os.Stat(filename)
+	if err == nil {
+		mode = fi.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dirname, "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpname := f.Name()
+	renamed := false
+	defer func() {
+		if !renamed {
+			os.Remove(tmpname)
+		}
+	}()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if err == nil && fi != nil {
+		err = chownLike(f, fi)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpname, filename)
+	if err != nil {
+		return err
+	}
+	renamed = true
+
+	return syncDir(dirname)
+}
@@ -0,0 +1,18 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package hconf
+
+import (
+	"os"
+)
+
+// Owners and directory syncs are left alone on this platform.
+
+func chownLike(f *os.File, fi os.FileInfo) error {
+	return nil
+}
+
+func syncDir(dirname string) error {
+	return nil
+}
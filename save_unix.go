@@ -0,0 +1,33 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package hconf
+
+import (
+	"os"
+	"syscall"
+)
+
+// chownLike gives f the owner of fi. Only root can change owners, so it
+// does nothing for other users.
+func chownLike(f *os.File, fi os.FileInfo) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return f.Chown(int(st.Uid), int(st.Gid))
+}
+
+// syncDir flushes a rename in dirname to disk.
+func syncDir(dirname string) error {
+	d, err := os.Open(dirname)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
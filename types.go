@@ -1,6 +1,8 @@
 package hconf
 
 import (
+	"time"
+
 	"github.com/hashicorp/hcl/hcl/token"
 )
 
@@ -12,6 +14,22 @@ type stringSliceSetter interface {
 	SetValue(v []string)
 }
 
+type int64SliceSetter interface {
+	SetValue(v []int64)
+}
+
+type boolSliceSetter interface {
+	SetValue(v []bool)
+}
+
+type float64SliceSetter interface {
+	SetValue(v []float64)
+}
+
+type stringMapSetter interface {
+	SetValue(v map[string]string)
+}
+
 type int64Setter interface {
 	SetValue(v int64)
 }
@@ -20,6 +38,14 @@ type boolSetter interface {
 	SetValue(v bool)
 }
 
+type float64Setter interface {
+	SetValue(v float64)
+}
+
+type durationSetter interface {
+	SetValue(v time.Duration)
+}
+
 type sourceSetter interface {
 	SetSource(p token.Pos)
 }
@@ -28,17 +54,78 @@ type sourceGetter interface {
 	Source() token.Pos
 }
 
+type stringValuer interface {
+	ValueString() string
+}
+
+type stringSliceValuer interface {
+	ValueStringSlice() []string
+}
+
+type int64SliceValuer interface {
+	ValueInt64Slice() []int64
+}
+
+type boolSliceValuer interface {
+	ValueBoolSlice() []bool
+}
+
+type float64SliceValuer interface {
+	ValueFloat64Slice() []float64
+}
+
+type stringMapValuer interface {
+	ValueStringMap() map[string]string
+}
+
+type int64Valuer interface {
+	ValueInt64() int64
+}
+
+type boolValuer interface {
+	ValueBool() bool
+}
+
+type float64Valuer interface {
+	ValueFloat64() float64
+}
+
+type durationValuer interface {
+	ValueDuration() time.Duration
+}
+
+type isSetter interface {
+	IsSet() bool
+}
+
+type defaultGetter interface {
+	IsDefault() bool
+}
+
+type defaultMarker interface {
+	markDefault()
+}
+
+type entrySourceSetter interface {
+	setEntrySources(sources map[string]token.Pos)
+}
+
+// DefaultSource is the Source of values filled in from an hdefault tag.
+var DefaultSource = token.Pos{Filename: "hdefault"}
+
 type String struct {
-	source token.Pos
-	value  string
-	isset  bool
+	source    token.Pos
+	value     string
+	isset     bool
+	isdefault bool
 }
 
 func (s *String) Duplicate() String {
 	return String{
-		source: s.source,
-		value:  s.value,
-		isset:  s.isset,
+		source:    s.source,
+		value:     s.value,
+		isset:     s.isset,
+		isdefault: s.isdefault,
 	}
 }
 
@@ -53,6 +140,7 @@ func (s *String) Source() token.Pos {
 func (s *String) SetValue(v string) {
 	s.value = v
 	s.isset = true
+	s.isdefault = false
 }
 
 func (s *String) Value() string {
@@ -67,10 +155,21 @@ func (s *String) IsSet() bool {
 	return s.isset
 }
 
+func (s *String) IsDefault() bool {
+	return s.isdefault
+}
+
+func (s *String) markDefault() {
+	s.source = DefaultSource
+	s.isset = false
+	s.isdefault = true
+}
+
 type StringSlice struct {
-	source token.Pos
-	value  []string
-	isset  bool
+	source    token.Pos
+	value     []string
+	isset     bool
+	isdefault bool
 }
 
 func (s *StringSlice) Duplicate() StringSlice {
@@ -78,9 +177,10 @@ func (s *StringSlice) Duplicate() StringSlice {
 	b = append(b, s.value...)
 
 	return StringSlice{
-		source: s.source,
-		value:  b,
-		isset:  s.isset,
+		source:    s.source,
+		value:     b,
+		isset:     s.isset,
+		isdefault: s.isdefault,
 	}
 }
 
@@ -95,6 +195,7 @@ func (s *StringSlice) Source() token.Pos {
 func (s *StringSlice) SetValue(v []string) {
 	s.value = v
 	s.isset = true
+	s.isdefault = false
 }
 
 func (s *StringSlice) Value() []string {
@@ -109,10 +210,272 @@ func (s *StringSlice) IsSet() bool {
 	return s.isset
 }
 
+func (s *StringSlice) IsDefault() bool {
+	return s.isdefault
+}
+
+func (s *StringSlice) markDefault() {
+	s.source = DefaultSource
+	s.isset = false
+	s.isdefault = true
+}
+
+type Int64Slice struct {
+	source    token.Pos
+	value     []int64
+	isset     bool
+	isdefault bool
+}
+
+func (s *Int64Slice) Duplicate() Int64Slice {
+	b := make([]int64, 0, len(s.value))
+	b = append(b, s.value...)
+
+	return Int64Slice{
+		source:    s.source,
+		value:     b,
+		isset:     s.isset,
+		isdefault: s.isdefault,
+	}
+}
+
+func (s *Int64Slice) SetSource(p token.Pos) {
+	s.source = p
+}
+
+func (s *Int64Slice) Source() token.Pos {
+	return s.source
+}
+
+func (s *Int64Slice) SetValue(v []int64) {
+	s.value = v
+	s.isset = true
+	s.isdefault = false
+}
+
+func (s *Int64Slice) Value() []int64 {
+	return s.value
+}
+
+func (s *Int64Slice) ValueInt64Slice() []int64 {
+	return s.value
+}
+
+func (s *Int64Slice) IsSet() bool {
+	return s.isset
+}
+
+func (s *Int64Slice) IsDefault() bool {
+	return s.isdefault
+}
+
+func (s *Int64Slice) markDefault() {
+	s.source = DefaultSource
+	s.isset = false
+	s.isdefault = true
+}
+
+type BoolSlice struct {
+	source    token.Pos
+	value     []bool
+	isset     bool
+	isdefault bool
+}
+
+func (s *BoolSlice) Duplicate() BoolSlice {
+	b := make([]bool, 0, len(s.value))
+	b = append(b, s.value...)
+
+	return BoolSlice{
+		source:    s.source,
+		value:     b,
+		isset:     s.isset,
+		isdefault: s.isdefault,
+	}
+}
+
+func (s *BoolSlice) SetSource(p token.Pos) {
+	s.source = p
+}
+
+func (s *BoolSlice) Source() token.Pos {
+	return s.source
+}
+
+func (s *BoolSlice) SetValue(v []bool) {
+	s.value = v
+	s.isset = true
+	s.isdefault = false
+}
+
+func (s *BoolSlice) Value() []bool {
+	return s.value
+}
+
+func (s *BoolSlice) ValueBoolSlice() []bool {
+	return s.value
+}
+
+func (s *BoolSlice) IsSet() bool {
+	return s.isset
+}
+
+func (s *BoolSlice) IsDefault() bool {
+	return s.isdefault
+}
+
+func (s *BoolSlice) markDefault() {
+	s.source = DefaultSource
+	s.isset = false
+	s.isdefault = true
+}
+
+type Float64Slice struct {
+	source    token.Pos
+	value     []float64
+	isset     bool
+	isdefault bool
+}
+
+func (s *Float64Slice) Duplicate() Float64Slice {
+	b := make([]float64, 0, len(s.value))
+	b = append(b, s.value...)
+
+	return Float64Slice{
+		source:    s.source,
+		value:     b,
+		isset:     s.isset,
+		isdefault: s.isdefault,
+	}
+}
+
+func (s *Float64Slice) SetSource(p token.Pos) {
+	s.source = p
+}
+
+func (s *Float64Slice) Source() token.Pos {
+	return s.source
+}
+
+func (s *Float64Slice) SetValue(v []float64) {
+	s.value = v
+	s.isset = true
+	s.isdefault = false
+}
+
+func (s *Float64Slice) Value() []float64 {
+	return s.value
+}
+
+func (s *Float64Slice) ValueFloat64Slice() []float64 {
+	return s.value
+}
+
+func (s *Float64Slice) IsSet() bool {
+	return s.isset
+}
+
+func (s *Float64Slice) IsDefault() bool {
+	return s.isdefault
+}
+
+func (s *Float64Slice) markDefault() {
+	s.source = DefaultSource
+	s.isset = false
+	s.isdefault = true
+}
+
+// StringMap holds an object of string values, such as
+// labels = { team = "infra" }.
+type StringMap struct {
+	source    token.Pos
+	sources   map[string]token.Pos
+	value     map[string]string
+	isset     bool
+	isdefault bool
+}
+
+func (s *StringMap) Duplicate() StringMap {
+	var value map[string]string
+	if s.value != nil {
+		value = make(map[string]string, len(s.value))
+		for k, v := range s.value {
+			value[k] = v
+		}
+	}
+
+	var sources map[string]token.Pos
+	if s.sources != nil {
+		sources = make(map[string]token.Pos, len(s.sources))
+		for k, p := range s.sources {
+			sources[k] = p
+		}
+	}
+
+	return StringMap{
+		source:    s.source,
+		sources:   sources,
+		value:     value,
+		isset:     s.isset,
+		isdefault: s.isdefault,
+	}
+}
+
+func (s *StringMap) SetSource(p token.Pos) {
+	s.source = p
+}
+
+func (s *StringMap) Source() token.Pos {
+	return s.source
+}
+
+// EntrySource returns where the entry for key was set, or Source if the
+// entry's own position is not known.
+func (s *StringMap) EntrySource(key string) token.Pos {
+	if p, ok := s.sources[key]; ok {
+		return p
+	}
+	return s.source
+}
+
+func (s *StringMap) setEntrySources(sources map[string]token.Pos) {
+	s.sources = sources
+}
+
+func (s *StringMap) SetValue(v map[string]string) {
+	s.value = v
+	s.sources = nil
+	s.isset = true
+	s.isdefault = false
+}
+
+func (s *StringMap) Value() map[string]string {
+	return s.value
+}
+
+func (s *StringMap) ValueStringMap() map[string]string {
+	return s.value
+}
+
+func (s *StringMap) IsSet() bool {
+	return s.isset
+}
+
+func (s *StringMap) IsDefault() bool {
+	return s.isdefault
+}
+
+func (s *StringMap) markDefault() {
+	s.source = DefaultSource
+	s.isset = false
+	s.isdefault = true
+}
+
 type Int64 struct {
-	source token.Pos
-	value  int64
-	isset  bool
+	source    token.Pos
+	value     int64
+	isset     bool
+	isdefault bool
 }
 
 func (s *Int64) SetSource(p token.Pos) {
@@ -126,6 +489,7 @@ func (s *Int64) Source() token.Pos {
 func (s *Int64) SetValue(v int64) {
 	s.value = v
 	s.isset = true
+	s.isdefault = false
 }
 
 func (s *Int64) Value() int64 {
@@ -140,17 +504,29 @@ func (s *Int64) IsSet() bool {
 	return s.isset
 }
 
+func (s *Int64) IsDefault() bool {
+	return s.isdefault
+}
+
+func (s *Int64) markDefault() {
+	s.source = DefaultSource
+	s.isset = false
+	s.isdefault = true
+}
+
 type Bool struct {
-	source token.Pos
-	value  bool
-	isset  bool
+	source    token.Pos
+	value     bool
+	isset     bool
+	isdefault bool
 }
 
 func (s *Bool) Duplicate() Bool {
 	return Bool{
-		source: s.source,
-		value:  s.value,
-		isset:  s.isset,
+		source:    s.source,
+		value:     s.value,
+		isset:     s.isset,
+		isdefault: s.isdefault,
 	}
 }
 
@@ -165,6 +541,7 @@ func (s *Bool) Source() token.Pos {
 func (s *Bool) SetValue(v bool) {
 	s.value = v
 	s.isset = true
+	s.isdefault = false
 }
 
 func (s *Bool) Value() bool {
@@ -178,3 +555,119 @@ func (s *Bool) ValueBool() bool {
 func (s *Bool) IsSet() bool {
 	return s.isset
 }
+
+func (s *Bool) IsDefault() bool {
+	return s.isdefault
+}
+
+func (s *Bool) markDefault() {
+	s.source = DefaultSource
+	s.isset = false
+	s.isdefault = true
+}
+
+type Float64 struct {
+	source    token.Pos
+	value     float64
+	isset     bool
+	isdefault bool
+}
+
+func (s *Float64) Duplicate() Float64 {
+	return Float64{
+		source:    s.source,
+		value:     s.value,
+		isset:     s.isset,
+		isdefault: s.isdefault,
+	}
+}
+
+func (s *Float64) SetSource(p token.Pos) {
+	s.source = p
+}
+
+func (s *Float64) Source() token.Pos {
+	return s.source
+}
+
+func (s *Float64) SetValue(v float64) {
+	s.value = v
+	s.isset = true
+	s.isdefault = false
+}
+
+func (s *Float64) Value() float64 {
+	return s.value
+}
+
+func (s *Float64) ValueFloat64() float64 {
+	return s.value
+}
+
+func (s *Float64) IsSet() bool {
+	return s.isset
+}
+
+func (s *Float64) IsDefault() bool {
+	return s.isdefault
+}
+
+func (s *Float64) markDefault() {
+	s.source = DefaultSource
+	s.isset = false
+	s.isdefault = true
+}
+
+// Duration is decoded from a string such as "30s" or "5m", or from an
+// integer number of seconds.
+type Duration struct {
+	source    token.Pos
+	value     time.Duration
+	isset     bool
+	isdefault bool
+}
+
+func (s *Duration) Duplicate() Duration {
+	return Duration{
+		source:    s.source,
+		value:     s.value,
+		isset:     s.isset,
+		isdefault: s.isdefault,
+	}
+}
+
+func (s *Duration) SetSource(p token.Pos) {
+	s.source = p
+}
+
+func (s *Duration) Source() token.Pos {
+	return s.source
+}
+
+func (s *Duration) SetValue(v time.Duration) {
+	s.value = v
+	s.isset = true
+	s.isdefault = false
+}
+
+func (s *Duration) Value() time.Duration {
+	return s.value
+}
+
+func (s *Duration) ValueDuration() time.Duration {
+	return s.value
+}
+
+func (s *Duration) IsSet() bool {
+	return s.isset
+}
+
+func (s *Duration) IsDefault() bool {
+	return s.isdefault
+}
+
+func (s *Duration) markDefault() {
+	s.source = DefaultSource
+	s.isset = false
+	s.isdefault = true
+}
@@ -0,0 +1,252 @@
+package hconf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+const (
+	tagRequired = "hrequired"
+	tagMin      = "hmin"
+	tagMax      = "hmax"
+	tagEnum     = "henum"
+	tagRegex    = "hregex"
+)
+
+var validateTags = []string{tagRequired, tagMin, tagMax, tagEnum, tagRegex}
+
+// Validate checks the hrequired, hmin, hmax, henum and hregex tags of out.
+// Decode and DecodeFiles call it once all input has been read; call it
+// directly after changing values with Set or DecodeEnv.
+//
+// hrequired:"true" fails when a key was neither set by the configuration
+// nor given a default by hdefault.
+// hmin and hmax bound numbers and durations, and the length of strings and
+// string slices. henum:"a,b,c" lists the allowed strings, and hregex gives a
+// regular expression that strings must match in full.
+func (hc *HC) Validate(out interface{}) error {
+	st := hc.newDecodeState()
+	err := hc.validate(st, out)
+	if err != nil {
+		return err
+	}
+	return st.err()
+}
+
+func (hc *HC) validate(st *decodeState, out interface{}) error {
+	val := reflect.ValueOf(out)
+	if val.Kind() != reflect.Ptr {
+		return errors.New("out must be a pointer")
+	}
+
+	for _, kf := range hc.keyFields(val) {
+		vif := kf.value.Addr().Interface()
+		set, ok := vif.(isSetter)
+		if !ok {
+			// plain types cannot tell whether they were set, so like
+			// hdefault the tags are refused rather than ignored
+			for _, tag := range validateTags {
+				if _, ok := kf.field.Tag.Lookup(tag); ok {
+					return fmt.Errorf("%s: %s tag is not supported on %s", kf.path(), tag, kf.value.Type())
+				}
+			}
+			continue
+		}
+
+		// a value filled in from hdefault satisfies hrequired, and is
+		// checked like a set value
+		if dg, ok := vif.(defaultGetter); !set.IsSet() && (!ok || !dg.IsDefault()) {
+			if kf.field.Tag.Get(tagRequired) == "true" {
+				err := st.report(posError(st.sectionPos(kf.block()), fmt.Errorf("missing required key: %s", kf.path())))
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		violation, err := checkConstraints(kf, vif)
+		if err != nil {
+			return err
+		}
+
+		if violation != "" {
+			var pos token.Pos
+			if sg, ok := vif.(sourceGetter); ok {
+				pos = sg.Source()
+			}
+			err = st.report(posError(pos, fmt.Errorf("%s: %s", kf.path(), violation)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// posError returns err at pos, or err alone if pos is unknown, as it is
+// for values that were only ever set with Set.
+func posError(pos token.Pos, err error) error {
+	if pos == (token.Pos{}) {
+		return err
+	}
+	return &parser.PosError{
+		Pos: pos,
+		Err: err,
+	}
+}
+
+// checkConstraints describes the first constraint vif violates, or returns
+// an empty string. Malformed tags are returned as an error.
+func checkConstraints(kf keyField, vif interface{}) (string, error) {
+	if min, ok := kf.field.Tag.Lookup(tagMin); ok {
+		violation, err := checkBound(kf, vif, tagMin, min)
+		if err != nil || violation != "" {
+			return violation, err
+		}
+	}
+
+	if max, ok := kf.field.Tag.Lookup(tagMax); ok {
+		violation, err := checkBound(kf, vif, tagMax, max)
+		if err != nil || violation != "" {
+			return violation, err
+		}
+	}
+
+	if enum, ok := kf.field.Tag.Lookup(tagEnum); ok {
+		values, err := constraintStrings(kf, vif, tagEnum)
+		if err != nil {
+			return "", err
+		}
+
+		allowed := strings.Split(enum, ",")
+		for i := range allowed {
+			allowed[i] = strings.TrimSpace(allowed[i])
+		}
+
+		for _, v := range values {
+			if !containsString(allowed, v) {
+				return fmt.Sprintf("'%s' must be one of: %s", v, strings.Join(allowed, ", ")), nil
+			}
+		}
+	}
+
+	if expr, ok := kf.field.Tag.Lookup(tagRegex); ok {
+		values, err := constraintStrings(kf, vif, tagRegex)
+		if err != nil {
+			return "", err
+		}
+
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return "", fmt.Errorf("%s: invalid %s tag: %v", kf.path(), tagRegex, err)
+		}
+
+		for _, v := range values {
+			if !re.MatchString(v) {
+				return fmt.Sprintf("'%s' must match %s", v, expr), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// checkBound compares vif against an hmin or hmax tag.
+func checkBound(kf keyField, vif interface{}, tag string, bound string) (string, error) {
+	var cmp int
+	var what string
+	switch v := vif.(type) {
+	case int64Valuer:
+		b, err := strconv.ParseInt(bound, 0, 64)
+		if err != nil {
+			return "", fmt.Errorf("%s: invalid %s tag: %v", kf.path(), tag, err)
+		}
+		cmp = compareInt64(v.ValueInt64(), b)
+		what = "value"
+	case float64Valuer:
+		b, err := strconv.ParseFloat(bound, 64)
+		if err != nil {
+			return "", fmt.Errorf("%s: invalid %s tag: %v", kf.path(), tag, err)
+		}
+		switch f := v.ValueFloat64(); {
+		case f < b:
+			cmp = -1
+		case f > b:
+			cmp = 1
+		}
+		what = "value"
+	case durationValuer:
+		b, err := parseDuration(bound)
+		if err != nil {
+			return "", fmt.Errorf("%s: invalid %s tag: %v", kf.path(), tag, err)
+		}
+		cmp = compareInt64(int64(v.ValueDuration()), int64(b))
+		what = "duration"
+	case stringValuer, stringSliceValuer, stringMapValuer:
+		b, err := strconv.ParseInt(bound, 0, 64)
+		if err != nil {
+			return "", fmt.Errorf("%s: invalid %s tag: %v", kf.path(), tag, err)
+		}
+		var n int
+		switch v := v.(type) {
+		case stringValuer:
+			n = utf8.RuneCountInString(v.ValueString())
+		case stringSliceValuer:
+			n = len(v.ValueStringSlice())
+		case stringMapValuer:
+			n = len(v.ValueStringMap())
+		}
+		cmp = compareInt64(int64(n), b)
+		what = "length"
+	default:
+		return "", fmt.Errorf("%s: %s tag is not supported on %T", kf.path(), tag, vif)
+	}
+
+	if tag == tagMin && cmp < 0 {
+		return fmt.Sprintf("%s must be at least %s", what, bound), nil
+	}
+	if tag == tagMax && cmp > 0 {
+		return fmt.Sprintf("%s must be at most %s", what, bound), nil
+	}
+	return "", nil
+}
+
+// constraintStrings returns the strings henum and hregex are checked against.
+func constraintStrings(kf keyField, vif interface{}, tag string) ([]string, error) {
+	switch v := vif.(type) {
+	case stringValuer:
+		return []string{v.ValueString()}, nil
+	case stringSliceValuer:
+		return v.ValueStringSlice(), nil
+	}
+	return nil, fmt.Errorf("%s: %s tag is not supported on %T", kf.path(), tag, vif)
+}
+
+func compareInt64(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}